@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// checkAgentRegistration looks for an SSM agent that registered under a
+// different managed instance ID, which happens when an AMI is baked with an
+// agent that was already registered (typically as a hybrid "mi-" instance).
+// The instance then never shows up under its own ID.
+func checkAgentRegistration(ctx context.Context, ssmClient *ssm.Client, instance *types.Instance) DiagnosticResult {
+	instanceID := derefOr(instance.InstanceId, "")
+	privateIPs := collectPrivateIPs(*instance)
+
+	own, err := ssmClient.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{Key: stringPtr("InstanceIds"), Values: []string{instanceID}},
+		},
+	})
+	if err != nil {
+		return DiagnosticResult{
+			CheckName: "SSM Agent Registration",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("Could not check SSM registration: %v", wrapAccessDenied(err, "ssm:DescribeInstanceInformation")),
+		}
+	}
+	if len(own.InstanceInformationList) > 0 {
+		info := own.InstanceInformationList[0]
+		if info.IPAddress != nil && len(privateIPs) > 0 && !slices.Contains(privateIPs, *info.IPAddress) {
+			return DiagnosticResult{
+				CheckName: "SSM Agent Registration",
+				Status:    "WARN",
+				Message: fmt.Sprintf(
+					"SSM reports IP %s for %s, which is not one of its private IPs (%s) - the agent may belong to another machine",
+					*info.IPAddress, instanceID, strings.Join(privateIPs, ", "),
+				),
+				Remediation: agentReregisterCommands(""),
+			}
+		}
+		return DiagnosticResult{
+			CheckName: "SSM Agent Registration",
+			Status:    "PASS",
+			Message:   "SSM agent is registered under the instance's own ID",
+		}
+	}
+
+	// Not registered under its own ID; look for a managed instance reporting
+	// one of this instance's IPs or its hostname.
+	hostname := derefOr(instance.PrivateDnsName, "")
+	paginator := ssm.NewDescribeInstanceInformationPaginator(ssmClient, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{Key: stringPtr("ResourceType"), Values: []string{string(ssmtypes.ResourceTypeManagedInstance)}},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return DiagnosticResult{
+				CheckName: "SSM Agent Registration",
+				Status:    "WARN",
+				Message:   fmt.Sprintf("Could not search managed instances: %v", err),
+			}
+		}
+		for _, info := range page.InstanceInformationList {
+			ipMatch := info.IPAddress != nil && slices.Contains(privateIPs, *info.IPAddress)
+			hostMatch := hostname != "" && info.ComputerName != nil && strings.EqualFold(*info.ComputerName, hostname)
+			if !ipMatch && !hostMatch {
+				continue
+			}
+			managedID := derefOr(info.InstanceId, "unknown")
+			return DiagnosticResult{
+				CheckName: "SSM Agent Registration",
+				Status:    "WARN",
+				Message: fmt.Sprintf(
+					"The agent on %s appears to be registered as %s (reused AMI with a baked-in registration?) - it must be re-registered",
+					instanceID, managedID,
+				),
+				Remediation: agentReregisterCommands(managedID),
+			}
+		}
+	}
+
+	return DiagnosticResult{
+		CheckName: "SSM Agent Registration",
+		Status:    "PASS",
+		Message:   "No conflicting SSM agent registration found",
+	}
+}
+
+// agentReregisterCommands returns the steps that clear a stale agent
+// registration. The on-instance steps are comments since they cannot be run
+// through SSM on an instance SSM cannot reach.
+func agentReregisterCommands(staleID string) []string {
+	var commands []string
+	if strings.HasPrefix(staleID, "mi-") {
+		commands = append(commands, "aws ssm deregister-managed-instance --instance-id "+staleID)
+	}
+	return append(commands,
+		"# On the instance: remove the baked-in registration and restart the agent",
+		"# sudo rm -rf /var/lib/amazon/ssm/registration /var/lib/amazon/ssm/Vault",
+		"# sudo systemctl restart amazon-ssm-agent",
+	)
+}
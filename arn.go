@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ARN holds the components of an Amazon Resource Name in the form
+// arn:partition:service:region:account-id:resource.
+type ARN struct {
+	Partition string
+	Service   string
+	Region    string
+	AccountID string
+	Resource  string // e.g. "instance/i-0abc" or "instance-profile/my-profile"
+}
+
+// isARN reports whether s looks like an ARN.
+func isARN(s string) bool {
+	return strings.HasPrefix(s, "arn:")
+}
+
+// parseARN splits an ARN into its components.
+func parseARN(s string) (ARN, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ARN{}, fmt.Errorf("invalid ARN: %s", s)
+	}
+	return ARN{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountID: parts[4],
+		Resource:  parts[5],
+	}, nil
+}
+
+// ResourceName returns the final path segment of the resource, e.g.
+// "i-0abc" for "instance/i-0abc". It returns "" when the resource has no path.
+func (a ARN) ResourceName() string {
+	parts := strings.Split(a.Resource, "/")
+	if len(parts) >= 2 {
+		return parts[len(parts)-1]
+	}
+	return ""
+}
+
+// ResourceType returns the resource type prefix, e.g. "instance" for
+// "instance/i-0abc".
+func (a ARN) ResourceType() string {
+	resourceType, _, _ := strings.Cut(a.Resource, "/")
+	return resourceType
+}
+
+// instanceIDFromARN extracts the instance ID from an EC2 instance ARN such as
+// arn:aws:ec2:us-east-1:123456789012:instance/i-0abc.
+func instanceIDFromARN(s string) (string, error) {
+	a, err := parseARN(s)
+	if err != nil {
+		return "", err
+	}
+	if a.Service != "ec2" || a.ResourceType() != "instance" || a.ResourceName() == "" {
+		return "", fmt.Errorf("not an EC2 instance ARN: %s", s)
+	}
+	return a.ResourceName(), nil
+}
+
+// regionFromTarget returns the region of an EC2 instance ARN target, or ""
+// when target is not an instance ARN or the ARN omits the region.
+func regionFromTarget(target string) string {
+	target = strings.TrimSpace(target)
+	if !isARN(target) {
+		return ""
+	}
+	if _, err := instanceIDFromARN(target); err != nil {
+		return ""
+	}
+	a, _ := parseARN(target)
+	return a.Region
+}
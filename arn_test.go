@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestInstanceIDFromARN(t *testing.T) {
+	tests := []struct {
+		arn     string
+		want    string
+		wantErr bool
+	}{
+		{arn: "arn:aws:ec2:us-east-1:123456789012:instance/i-0abc", want: "i-0abc"},
+		{arn: "arn:aws-us-gov:ec2:us-gov-west-1:123456789012:instance/i-0def", want: "i-0def"},
+		{arn: "arn:aws:ec2:us-east-1:123456789012:volume/vol-0abc", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:instance-profile/web", wantErr: true},
+		{arn: "arn:aws:ec2:us-east-1:123456789012:instance/", wantErr: true},
+		{arn: "arn:aws:ec2:us-east-1:123456789012:instance", wantErr: true},
+		{arn: "arn:aws:ec2", wantErr: true},
+		{arn: "i-0abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := instanceIDFromARN(tt.arn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("instanceIDFromARN(%q) error = %v, wantErr %v", tt.arn, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("instanceIDFromARN(%q) = %q, want %q", tt.arn, got, tt.want)
+		}
+	}
+}
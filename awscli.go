@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// awsCLIUpgradeURL points users at the AWS CLI v2 installation guide.
+const awsCLIUpgradeURL = "https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html"
+
+// AWSCLIVersion represents the installed AWS CLI version as reported by `aws --version`.
+type AWSCLIVersion struct {
+	Major int    // The major version (1 or 2)
+	Minor int    // The minor version
+	Patch int    // The patch version
+	Raw   string // The raw version string, e.g. "aws-cli/2.15.30"
+}
+
+// supportsSessionReason reports whether start-session accepts --reason,
+// which was added in AWS CLI 2.13.
+func (v AWSCLIVersion) supportsSessionReason() bool {
+	return v.Major > 2 || (v.Major == 2 && v.Minor >= 13)
+}
+
+// String returns the version in MAJOR.MINOR.PATCH form.
+func (v AWSCLIVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// The detected AWS CLI version is cached for the lifetime of the process so
+// that `aws --version` is only executed once per run.
+var (
+	awsCLIVersionOnce   sync.Once
+	awsCLIVersionCached AWSCLIVersion
+	awsCLIVersionErr    error
+)
+
+// detectAWSCLIVersion runs `aws --version` and parses its output. The result
+// is cached, so subsequent calls return the first detection.
+func detectAWSCLIVersion() (AWSCLIVersion, error) {
+	awsCLIVersionOnce.Do(func() {
+		// AWS CLI v1 running on older Python versions prints its version to
+		// stderr, so capture both streams.
+		out, err := exec.Command("aws", "--version").CombinedOutput()
+		if err != nil {
+			awsCLIVersionErr = fmt.Errorf("failed to run aws --version: %v", err)
+			return
+		}
+		awsCLIVersionCached, awsCLIVersionErr = parseAWSCLIVersion(string(out))
+	})
+	return awsCLIVersionCached, awsCLIVersionErr
+}
+
+// parseAWSCLIVersion extracts the version from output such as
+// "aws-cli/2.15.30 Python/3.11.8 Darwin/23.3.0 exe/x86_64 prompt/off".
+func parseAWSCLIVersion(output string) (AWSCLIVersion, error) {
+	for _, field := range strings.Fields(output) {
+		if !strings.HasPrefix(field, "aws-cli/") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(field, "aws-cli/"), ".")
+		if len(parts) < 2 {
+			return AWSCLIVersion{}, fmt.Errorf("unrecognized aws cli version: %s", field)
+		}
+		nums := make([]int, 3)
+		for i := 0; i < len(parts) && i < 3; i++ {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil {
+				return AWSCLIVersion{}, fmt.Errorf("unrecognized aws cli version: %s", field)
+			}
+			nums[i] = n
+		}
+		return AWSCLIVersion{Major: nums[0], Minor: nums[1], Patch: nums[2], Raw: field}, nil
+	}
+	return AWSCLIVersion{}, fmt.Errorf("unrecognized aws --version output: %q", strings.TrimSpace(output))
+}
+
+// sessionManagerPluginBinary is the executable the AWS CLI launches to run
+// SSM sessions. On Windows the file has an .exe suffix, which os.Stat does
+// not add the way exec.LookPath does.
+var sessionManagerPluginBinary = func() string {
+	if runtime.GOOS == "windows" {
+		return "session-manager-plugin.exe"
+	}
+	return "session-manager-plugin"
+}()
+
+// sessionManagerPluginInstallURL points users at the plugin installation guide.
+const sessionManagerPluginInstallURL = "https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"
+
+// resolvePluginDir returns the directory containing the session manager
+// plugin for a --plugin-path value, which may name either the binary itself
+// or the directory containing it.
+func resolvePluginDir(pluginPath string) (string, error) {
+	info, err := os.Stat(pluginPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid plugin path: %v", err)
+	}
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(pluginPath, sessionManagerPluginBinary)); err != nil {
+			return "", fmt.Errorf("%s not found in %s", sessionManagerPluginBinary, pluginPath)
+		}
+		return pluginPath, nil
+	}
+	return filepath.Dir(pluginPath), nil
+}
+
+// findSessionManagerPlugin reports whether the session manager plugin can be
+// found in pluginDir (when set) or on the PATH.
+func findSessionManagerPlugin(pluginDir string) bool {
+	if pluginDir != "" {
+		if _, err := os.Stat(filepath.Join(pluginDir, sessionManagerPluginBinary)); err == nil {
+			return true
+		}
+	}
+	_, err := exec.LookPath(sessionManagerPluginBinary)
+	return err == nil
+}
+
+// pluginPathEnv returns the environment entries that let the AWS CLI find the
+// session manager plugin in pluginDir by prepending it to PATH.
+func pluginPathEnv(pluginDir string) []string {
+	if pluginDir == "" {
+		return nil
+	}
+	return []string{"PATH=" + pluginDir + string(os.PathListSeparator) + os.Getenv("PATH")}
+}
+
+// managedSessionFlags are the start-session flags quick_ssm sets itself and
+// which therefore may not be passed through after "--". --reason and
+// --endpoint-url are included even when --ticket or --endpoint-url are not
+// given, since they must match what quick_ssm uses for its own API calls and
+// records; use the quick_ssm flags instead.
+var managedSessionFlags = []string{
+	"--target", "--document-name", "--parameters", "--region", "--reason", "--endpoint-url",
+}
+
+// validatePassthroughArgs rejects pass-through arguments that would conflict
+// with the managed flags quick_ssm passes to aws ssm start-session.
+func validatePassthroughArgs(args []string, managedFlags ...string) error {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		for _, managed := range managedFlags {
+			if name == managed {
+				return fmt.Errorf("%s is managed by quick_ssm and cannot be passed after --", managed)
+			}
+		}
+	}
+	return nil
+}
+
+// sessionManagerPluginExecutable returns the path of the session manager
+// plugin in pluginDir (when set) or on the PATH.
+func sessionManagerPluginExecutable(pluginDir string) (string, error) {
+	if pluginDir != "" {
+		path := filepath.Join(pluginDir, sessionManagerPluginBinary)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath(sessionManagerPluginBinary)
+	if err != nil {
+		return "", fmt.Errorf("%s not found: %s", sessionManagerPluginBinary, sessionManagerPluginInstallURL)
+	}
+	return path, nil
+}
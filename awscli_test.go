@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestParseAWSCLIVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    AWSCLIVersion
+		wantErr bool
+	}{
+		{
+			output: "aws-cli/2.15.30 Python/3.11.8 Darwin/23.3.0 exe/x86_64 prompt/off\n",
+			want:   AWSCLIVersion{Major: 2, Minor: 15, Patch: 30, Raw: "aws-cli/2.15.30"},
+		},
+		{
+			output: "aws-cli/1.18.69 Python/2.7.18 Linux/5.4.0 botocore/1.16.19",
+			want:   AWSCLIVersion{Major: 1, Minor: 18, Patch: 69, Raw: "aws-cli/1.18.69"},
+		},
+		{output: "aws-cli/2.1", want: AWSCLIVersion{Major: 2, Minor: 1, Raw: "aws-cli/2.1"}},
+		{output: "aws-cli/2", wantErr: true},
+		{output: "aws-cli/2.x.1", wantErr: true},
+		{output: "command not found", wantErr: true},
+		{output: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseAWSCLIVersion(tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAWSCLIVersion(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAWSCLIVersion(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePassthroughArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: nil},
+		{args: []string{"--debug"}},
+		{args: []string{"--profile", "dev", "--cli-read-timeout", "0"}},
+		{args: []string{"--target", "i-0abc"}, wantErr: true},
+		{args: []string{"--debug", "--region=us-west-2"}, wantErr: true},
+		{args: []string{"--reason", "ticket"}, wantErr: true},
+		{args: []string{"--endpoint-url=https://ssm.example.com"}, wantErr: true},
+		{args: []string{"--parameters", "{}"}, wantErr: true},
+		{args: []string{"--document-name", "AWS-StartPortForwardingSession"}, wantErr: true},
+		{args: []string{"--targets", "i-0abc"}},
+	}
+	for _, tt := range tests {
+		err := validatePassthroughArgs(tt.args, managedSessionFlags...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validatePassthroughArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/smithy-go"
+)
+
+// MissingPermissionError indicates that the caller's credentials are not
+// allowed to perform Action. It lets diagnostics distinguish "your
+// permissions" problems from problems with the instance itself.
+type MissingPermissionError struct {
+	Action string // The IAM action that was denied, e.g. "iam:ListRolePolicies"
+	Err    error  // The underlying SDK error
+}
+
+func (e *MissingPermissionError) Error() string {
+	return fmt.Sprintf("missing permission %s: %v", e.Action, e.Err)
+}
+
+func (e *MissingPermissionError) Unwrap() error {
+	return e.Err
+}
+
+// isAccessDenied reports whether err is an AWS authorization failure.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	default:
+		return false
+	}
+}
+
+// wrapAccessDenied converts authorization failures into a
+// MissingPermissionError for action. Other errors are returned unchanged.
+func wrapAccessDenied(err error, action string) error {
+	if isAccessDenied(err) {
+		return &MissingPermissionError{Action: action, Err: err}
+	}
+	return err
+}
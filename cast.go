@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// castHeader is the first line of an asciinema v2 .cast file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castRecorder writes terminal output as an asciinema v2 .cast file: a
+// header line followed by one [seconds, "o", data] event per write, so a
+// session can be replayed with its original timing.
+type castRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	start   time.Time
+	pending []byte // Trailing bytes of a UTF-8 sequence split across writes
+}
+
+// castPath returns where to record a session on inst. When path is an
+// existing directory, a file named after the instance and time is created
+// in it.
+func castPath(path string, inst *InstanceInfo) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, fmt.Sprintf("%s-%s.cast", inst.ID, time.Now().Format("20060102-150405")))
+	}
+	return path
+}
+
+// newCastRecorder creates the .cast file at path. The terminal size is
+// recorded once, from the start of the session.
+func newCastRecorder(path string, width, height int, title string) (*castRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &castRecorder{file: file, w: bufio.NewWriter(file), start: time.Now()}
+	header, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.w.Write(append(header, '\n'))
+	return r, nil
+}
+
+// Write records p as an output event. Multi-byte characters split across
+// writes are held back until complete, since events must be valid UTF-8.
+func (r *castRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return len(p), nil
+	}
+	return len(p), r.event(data[:cut])
+}
+
+// event writes one output event.
+func (r *castRecorder) event(data []byte) error {
+	line, err := json.Marshal([]any{time.Since(r.start).Seconds(), "o", string(data)})
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close flushes any held-back bytes and closes the file.
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.event(r.pending)
+		r.pending = nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
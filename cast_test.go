@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCastRecorderWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string // The data of each output event
+	}{
+		{name: "ascii", writes: []string{"ls\r\n", "ok"}, want: []string{"ls\r\n", "ok"}},
+		{name: "split two-byte rune", writes: []string{"caf\xc3", "\xa9!"}, want: []string{"caf", "é!"}},
+		{name: "split four-byte rune", writes: []string{"\xf0\x9f", "\x98", "\x80"}, want: []string{"😀"}},
+		{name: "incomplete rune flushed on close", writes: []string{"a\xe2\x82"}, want: []string{"a", "\ufffd\ufffd"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "session.cast")
+		r, err := newCastRecorder(path, 80, 24, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range tt.writes {
+			if n, err := r.Write([]byte(w)); err != nil || n != len(w) {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, w, n, err)
+			}
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		var header castHeader
+		if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width != 80 {
+			t.Errorf("%s: bad header %q: %v", tt.name, lines[0], err)
+		}
+		got := []string{}
+		for _, line := range lines[1:] {
+			var event []any
+			if err := json.Unmarshal([]byte(line), &event); err != nil || len(event) != 3 || event[1] != "o" {
+				t.Fatalf("%s: bad event %q: %v", tt.name, line, err)
+			}
+			got = append(got, event[2].(string))
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: events = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// checkAllWorkers bounds how many instances are diagnosed concurrently so
+// that large accounts do not trip API rate limits.
+const checkAllWorkers = 8
+
+// InstanceCheck holds the diagnostic results for a single instance in a
+// --check-all run.
+type InstanceCheck struct {
+	Instance *InstanceInfo
+	VpcID    string // From the instance details the checks ran against
+	SubnetID string
+	Results  []DiagnosticResult
+	Err      error
+}
+
+// Supported values for --group-by.
+const (
+	groupByNone   = "none"
+	groupByVPC    = "vpc"
+	groupBySubnet = "subnet"
+)
+
+// isValidGroupBy reports whether value is an accepted --group-by value.
+func isValidGroupBy(value string) bool {
+	return value == groupByNone || value == groupByVPC || value == groupBySubnet
+}
+
+// progressReporter renders "N/M instances checked" on a single rewriting line.
+// It is a no-op when disabled, e.g. under --quiet or when stdout is not a TTY.
+type progressReporter struct {
+	mu      sync.Mutex
+	enabled bool
+	total   int
+	done    int
+}
+
+func (p *progressReporter) increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.enabled {
+		fmt.Printf("\r%s", color(fmt.Sprintf("%d/%d instances checked", p.done, p.total), qc.ColorCyan))
+	}
+}
+
+func (p *progressReporter) finish() {
+	if p.enabled {
+		// Clear the progress line before printing the summary
+		fmt.Printf("\r%s\r", strings.Repeat(" ", 40))
+	}
+}
+
+// checkAllInstances runs the diagnostic checks against every instance using a
+// bounded pool of workers. Results are returned in the same order as instances.
+func checkAllInstances(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, ssmClient *ssm.Client, instances []*InstanceInfo, opts DiagnosticOptions, quiet bool) []InstanceCheck {
+	checks := make([]InstanceCheck, len(instances))
+	progress := &progressReporter{
+		enabled: !quiet && isTerminal(os.Stdout),
+		total:   len(instances),
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < checkAllWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				checks[i] = InstanceCheck{Instance: instances[i]}
+				instance, err := getInstanceDetails(ctx, ec2Client, instances[i].ID)
+				if err != nil {
+					checks[i].Err = fmt.Errorf("failed to get instance details: %v", err)
+				} else {
+					checks[i].VpcID = derefOr(instance.VpcId, "")
+					checks[i].SubnetID = derefOr(instance.SubnetId, "")
+					checks[i].Results = runDiagnosticsOn(ctx, ec2Client, iamClient, ssmClient, instance, opts)
+				}
+				progress.increment()
+			}
+		}()
+	}
+	for i := range instances {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	progress.finish()
+
+	return checks
+}
+
+// displayCheckAllResults prints one line per instance with its check counts
+// and the names of any failed checks, followed by fleet-wide totals. With
+// groupBy vpc or subnet, the lines are grouped under a header per network
+// with its own verdict, so problems shared by a whole VPC stand out. With
+// summaryOnly, only the totals and a final PASS, WARN, or FAIL line are
+// printed. It returns the number of ready, warned, and failed instances.
+func displayCheckAllResults(checks []InstanceCheck, groupBy string, summaryOnly bool) (ready, warned, failed int) {
+	fmt.Printf("\n%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
+	fmt.Printf("%s\n", colorBold("FLEET DIAGNOSTIC SUMMARY", qc.ColorPurple))
+	fmt.Printf("%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
+
+	longestName := 0
+	for _, c := range checks {
+		if len(c.Instance.DisplayName) > longestName {
+			longestName = len(c.Instance.DisplayName)
+		}
+	}
+
+	for _, group := range groupChecks(checks, groupBy) {
+		if groupBy != groupByNone && !summaryOnly {
+			printCheckGroupHeader(group)
+		}
+		for _, c := range group.Checks {
+			if !summaryOnly {
+				printInstanceCheck(c, longestName)
+			}
+			switch instanceVerdict(c) {
+			case "FAIL":
+				failed++
+			case "WARN":
+				warned++
+			default:
+				ready++
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", color("✅ Ready:", qc.ColorGreen), colorBold(fmt.Sprintf("%d", ready), qc.ColorGreen))
+	fmt.Printf("%s %s\n", color("⚠️  Warnings:", qc.ColorYellow), colorBold(fmt.Sprintf("%d", warned), qc.ColorYellow))
+	fmt.Printf("%s %s\n", color("❌ Failed:", qc.ColorRed), colorBold(fmt.Sprintf("%d", failed), qc.ColorRed))
+	if summaryOnly {
+		switch {
+		case failed > 0:
+			fmt.Printf("\n%s\n", color(fmt.Sprintf("❌ FAIL (%d of %d instances)", failed, len(checks)), qc.ColorRed))
+		case warned > 0:
+			fmt.Printf("\n%s\n", color("⚠️  WARN", qc.ColorYellow))
+		default:
+			fmt.Printf("\n%s\n", color("✅ PASS", qc.ColorGreen))
+		}
+	}
+	return ready, warned, failed
+}
+
+// countFailedInstances returns how many instances failed a check or could
+// not be checked at all.
+func countFailedInstances(checks []InstanceCheck) int {
+	failed := 0
+	for _, c := range checks {
+		if instanceVerdict(c) == "FAIL" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// instanceVerdict returns an instance's overall result: PASS, WARN, or
+// FAIL. Instances whose checks could not run count as FAIL.
+func instanceVerdict(c InstanceCheck) string {
+	_, warn, fail := countResults(c.Results)
+	switch {
+	case c.Err != nil || fail > 0:
+		return "FAIL"
+	case warn > 0:
+		return "WARN"
+	default:
+		return "PASS"
+	}
+}
+
+// printInstanceCheck prints one instance's line with its check counts.
+func printInstanceCheck(c InstanceCheck, longestName int) {
+	label := fmt.Sprintf("%-*s %s", longestName, c.Instance.DisplayName, c.Instance.ID)
+	if c.Err != nil {
+		fmt.Printf("❓ %s %s\n", label, color(c.Err.Error(), qc.ColorRed))
+		return
+	}
+
+	pass, warn, fail := countResults(c.Results)
+	counts := fmt.Sprintf("%d passed, %d warnings, %d failed", pass, warn, fail)
+	switch instanceVerdict(c) {
+	case "FAIL":
+		fmt.Printf("❌ %s %s %s\n", label, color(counts, qc.ColorRed), failedCheckNames(c.Results))
+	case "WARN":
+		fmt.Printf("⚠️  %s %s\n", label, color(counts, qc.ColorYellow))
+	default:
+		fmt.Printf("✅ %s %s\n", label, color(counts, qc.ColorGreen))
+	}
+}
+
+// CheckGroup is the --check-all results for one VPC or subnet.
+type CheckGroup struct {
+	Key    string // VPC ID, "VPC / subnet", or empty when not grouping
+	Checks []InstanceCheck
+}
+
+// groupChecks groups checks by VPC or subnet, in order of network ID.
+// Instances whose details could not be fetched are grouped as "unknown".
+// With groupByNone, all checks form a single group in their original order.
+func groupChecks(checks []InstanceCheck, groupBy string) []CheckGroup {
+	if groupBy == groupByNone {
+		return []CheckGroup{{Checks: checks}}
+	}
+	byKey := map[string]*CheckGroup{}
+	keys := []string{}
+	for _, c := range checks {
+		key := c.VpcID
+		if groupBy == groupBySubnet && c.SubnetID != "" {
+			key += " / " + c.SubnetID
+		}
+		if key == "" {
+			key = "unknown"
+		}
+		if byKey[key] == nil {
+			byKey[key] = &CheckGroup{Key: key}
+			keys = append(keys, key)
+		}
+		byKey[key].Checks = append(byKey[key].Checks, c)
+	}
+	sort.Strings(keys)
+	groups := make([]CheckGroup, len(keys))
+	for i, key := range keys {
+		groups[i] = *byKey[key]
+	}
+	return groups
+}
+
+// printCheckGroupHeader prints a network's header with its aggregate
+// verdict. Checks that fail on every instance in the group are named, since
+// they usually point at the network rather than the instances, e.g. a
+// private VPC without SSM endpoints.
+func printCheckGroupHeader(group CheckGroup) {
+	failing, warning := 0, 0
+	failCounts := map[string]int{}
+	for _, c := range group.Checks {
+		if c.Err != nil {
+			failing++
+			continue
+		}
+		_, warn, fail := countResults(c.Results)
+		switch {
+		case fail > 0:
+			failing++
+		case warn > 0:
+			warning++
+		}
+		for _, r := range c.Results {
+			if r.Status == "FAIL" {
+				failCounts[r.CheckName]++
+			}
+		}
+	}
+	common := []string{}
+	for name, count := range failCounts {
+		if count == len(group.Checks) {
+			common = append(common, name)
+		}
+	}
+	sort.Strings(common)
+
+	total := len(group.Checks)
+	var verdict, verdictColor string
+	switch {
+	case failing == total:
+		verdict, verdictColor = fmt.Sprintf("❌ all %d instances failed", total), qc.ColorRed
+	case failing > 0:
+		verdict, verdictColor = fmt.Sprintf("❌ %d of %d instances failed", failing, total), qc.ColorRed
+	case warning > 0:
+		verdict, verdictColor = fmt.Sprintf("⚠️  %d of %d instances have warnings", warning, total), qc.ColorYellow
+	default:
+		verdict, verdictColor = fmt.Sprintf("✅ all %d instances ready", total), qc.ColorGreen
+	}
+	if len(common) > 0 && total > 1 {
+		verdict += "; every instance fails " + strings.Join(common, ", ")
+	}
+	fmt.Printf("\n%s %s\n", colorBold(group.Key, qc.ColorBlue), color(verdict, verdictColor))
+}
+
+// failedCheckNames returns the names of the failed checks in results, e.g.
+// "(IAM Role Attachment, SSM Traffic Rules)".
+func failedCheckNames(results []DiagnosticResult) string {
+	names := []string{}
+	for _, r := range results {
+		if r.Status == "FAIL" {
+			names = append(names, r.CheckName)
+		}
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
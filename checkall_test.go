@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestGroupChecks(t *testing.T) {
+	checks := []InstanceCheck{
+		{Instance: &InstanceInfo{ID: "i-1"}, VpcID: "vpc-b", SubnetID: "subnet-2"},
+		{Instance: &InstanceInfo{ID: "i-2"}, VpcID: "vpc-a", SubnetID: "subnet-1"},
+		{Instance: &InstanceInfo{ID: "i-3"}},
+		{Instance: &InstanceInfo{ID: "i-4"}, VpcID: "vpc-b", SubnetID: "subnet-3"},
+		{Instance: &InstanceInfo{ID: "i-5"}, VpcID: "vpc-a"},
+	}
+	tests := []struct {
+		groupBy string
+		want    []string // "key: ids" per group
+	}{
+		{groupBy: groupByNone, want: []string{": [i-1 i-2 i-3 i-4 i-5]"}},
+		{groupBy: groupByVPC, want: []string{
+			"unknown: [i-3]",
+			"vpc-a: [i-2 i-5]",
+			"vpc-b: [i-1 i-4]",
+		}},
+		{groupBy: groupBySubnet, want: []string{
+			"unknown: [i-3]",
+			"vpc-a: [i-5]",
+			"vpc-a / subnet-1: [i-2]",
+			"vpc-b / subnet-2: [i-1]",
+			"vpc-b / subnet-3: [i-4]",
+		}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, group := range groupChecks(checks, tt.groupBy) {
+			ids := []string{}
+			for _, c := range group.Checks {
+				ids = append(ids, c.Instance.ID)
+			}
+			got = append(got, fmt.Sprintf("%s: %v", group.Key, ids))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("groupChecks(%s) = %q, want %q", tt.groupBy, got, tt.want)
+		}
+	}
+}
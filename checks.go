@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// DiagnosticClients is what a diagnostic check runs against: the AWS clients
+// and the instance under diagnosis, as returned by DescribeInstances.
+type DiagnosticClients struct {
+	EC2      *ec2.Client
+	IAM      *iam.Client
+	SSM      *ssm.Client
+	Instance *types.Instance
+}
+
+// DiagnosticCheck is a single diagnostic check. Name is the key used to
+// select the check with --only.
+type DiagnosticCheck interface {
+	Name() string
+	Run(ctx context.Context, clients DiagnosticClients) DiagnosticResult
+}
+
+// optInCheck is implemented by checks that only run when enabled by an
+// option, such as the metadata tags check with --require-metadata-tags.
+type optInCheck interface {
+	enabledBy(opts DiagnosticOptions) bool
+}
+
+// builtinCheck adapts one of the built-in check functions to DiagnosticCheck.
+type builtinCheck struct {
+	key   string
+	run   func(ctx context.Context, clients DiagnosticClients) DiagnosticResult
+	optIn func(opts DiagnosticOptions) bool // nil runs the check by default
+}
+
+func (c builtinCheck) Name() string { return c.key }
+
+func (c builtinCheck) Run(ctx context.Context, clients DiagnosticClients) DiagnosticResult {
+	return c.run(ctx, clients)
+}
+
+func (c builtinCheck) enabledBy(opts DiagnosticOptions) bool {
+	return c.optIn == nil || c.optIn(opts)
+}
+
+// diagnosticChecks is the check registry, in the order the checks run.
+// Custom checks added with RegisterCheck run after the built-ins.
+var diagnosticChecks = []DiagnosticCheck{
+	builtinCheck{key: checkKeyState, run: func(_ context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkInstanceState(c.Instance)
+	}},
+	builtinCheck{key: checkKeyIAM, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkIAMRole(ctx, c.IAM, c.Instance)
+	}},
+	builtinCheck{key: checkKeyInternet, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkInternetConnectivity(ctx, c.EC2, c.Instance)
+	}},
+	builtinCheck{key: checkKeySSM, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkSSMTrafficRules(ctx, c.EC2, c.Instance)
+	}},
+	builtinCheck{key: checkKeyNACL, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkNetworkACL(ctx, c.EC2, c.Instance)
+	}},
+	builtinCheck{key: checkKeyDNS, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkVPCDNS(ctx, c.EC2, c.Instance)
+	}},
+	builtinCheck{key: checkKeyAgent, run: func(ctx context.Context, c DiagnosticClients) DiagnosticResult {
+		return checkAgentRegistration(ctx, c.SSM, c.Instance)
+	}},
+	builtinCheck{
+		key: checkKeyMetadata,
+		run: func(_ context.Context, c DiagnosticClients) DiagnosticResult {
+			return checkInstanceMetadataTags(c.Instance)
+		},
+		optIn: func(opts DiagnosticOptions) bool { return opts.RequireMetadataTags },
+	},
+}
+
+// RegisterCheck adds a custom diagnostic check, typically from an init
+// function in a separate file. It panics if a check with the same name is
+// already registered.
+func RegisterCheck(check DiagnosticCheck) {
+	for _, c := range diagnosticChecks {
+		if c.Name() == check.Name() {
+			panic(fmt.Sprintf("diagnostic check %q is already registered", check.Name()))
+		}
+	}
+	diagnosticChecks = append(diagnosticChecks, check)
+}
+
+// checkNames returns the names of all registered checks in run order.
+func checkNames() []string {
+	names := make([]string, len(diagnosticChecks))
+	for i, c := range diagnosticChecks {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// isValidCheckKey reports whether key names a registered diagnostic check.
+func isValidCheckKey(key string) bool {
+	for _, c := range diagnosticChecks {
+		if c.Name() == key {
+			return true
+		}
+	}
+	return false
+}
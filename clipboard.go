@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// errNoClipboard is returned when no supported clipboard utility is installed.
+var errNoClipboard = errors.New("no clipboard utility found (install pbcopy, wl-copy, xclip, or xsel)")
+
+// clipboardCommands returns the candidate clipboard commands for the current
+// OS in order of preference.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		return [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+}
+
+// copyToClipboard writes text to the system clipboard using the first
+// available OS clipboard utility.
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errNoClipboard
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// colorEnabled controls whether ANSI colors are emitted. It is disabled for
+// non-interactive runs, --no-color, and when NO_COLOR is set.
+var colorEnabled = true
+
+// color wraps qc.Color, returning text unchanged when colors are disabled.
+func color(text, colorCode string) string {
+	if !colorEnabled {
+		return text
+	}
+	return qc.Color(text, colorCode)
+}
+
+// colorBold wraps qc.ColorizeBold, returning text unchanged when colors are
+// disabled.
+func colorBold(text, colorCode string) string {
+	if !colorEnabled {
+		return text
+	}
+	return qc.ColorizeBold(text, colorCode)
+}
+
+// noColorRequested reports whether the NO_COLOR convention (https://no-color.org)
+// asks for colors to be disabled.
+func noColorRequested() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// configFile is the name of the user configuration file within configDir.
+const configFile = "config.json"
+
+// Config is the user configuration read from configFile, e.g.:
+//
+//	{
+//	  "presets": {
+//	    "logs": "journalctl -u myapp -n 200",
+//	    "disk": {"shell": "df -h", "powershell": "Get-PSDrive -PSProvider FileSystem"}
+//	  },
+//	  "environments": {
+//	    "prod": ["123456789012"],
+//	    "staging": ["210987654321:us-west-2"]
+//	  },
+//	  "environmentColors": {"staging": "purple"},
+//	  "duplicateNames": "hash",
+//	  "deny": {
+//	    "123456789012": {"i-0abc123def456": "Primary database; use the DBA runbook"}
+//	  },
+//	  "hideDenied": true,
+//	  "targetPriority": ["role=primary", "role=replica"]
+//	}
+type Config struct {
+	Presets           map[string]CommandSpec       `json:"presets"`           // Named commands for --run-preset
+	Environments      map[string][]string          `json:"environments"`      // Account IDs or ACCOUNT:REGION pairs per environment
+	EnvironmentColors map[string]string            `json:"environmentColors"` // Header color overrides per environment
+	DuplicateNames    string                       `json:"duplicateNames"`    // Style for telling apart instances that share a name
+	Deny              map[string]map[string]string `json:"deny"`              // Per account, instance IDs never to connect to and why
+	HideDenied        bool                         `json:"hideDenied"`        // Leave denied instances out of the menu entirely
+	TargetPriority    []string                     `json:"targetPriority"`    // Tag expressions, most preferred first, for auto-selecting among --target matches
+}
+
+// loadConfig reads the user configuration from path, or from configFile in
+// configDir when path is empty. A missing default file yields an empty
+// configuration; a missing file given with --config is an error.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	explicit := path != ""
+	if !explicit {
+		dir, err := configDir()
+		if err != nil {
+			return cfg, err
+		}
+		path = filepath.Join(dir, configFile)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if explicit {
+			return cfg, fmt.Errorf("config file %s does not exist", path)
+		}
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// preset returns the named command preset.
+func (c Config) preset(name string) (CommandSpec, error) {
+	spec, ok := c.Presets[name]
+	if !ok {
+		return CommandSpec{}, fmt.Errorf("unknown preset %q (see --list-presets)", name)
+	}
+	return spec, nil
+}
+
+// printPresets lists the configured command presets.
+func printPresets(cfg Config) {
+	if len(cfg.Presets) == 0 {
+		fmt.Println("No presets defined. Add a \"presets\" object to", configFile)
+		return
+	}
+	names := make([]string, 0, len(cfg.Presets))
+	for name := range cfg.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := cfg.Presets[name]
+		fmt.Println(colorBold(name, qc.ColorCyan))
+		if spec.Shell != "" {
+			fmt.Printf("  shell:      %s\n", spec.Shell)
+		}
+		if spec.PowerShell != "" {
+			fmt.Printf("  powershell: %s\n", spec.PowerShell)
+		}
+	}
+}
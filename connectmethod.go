@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// Connection methods offered by --choose-method.
+const (
+	methodShell       = "shell"
+	methodPortForward = "port-forward"
+	methodRDP         = "rdp"
+)
+
+// connectMethods returns the methods viable for inst, in menu order. The
+// SSM shell is always first and is the default.
+func connectMethods(inst *InstanceInfo) []string {
+	methods := []string{methodShell, methodPortForward}
+	if isWindows(inst) {
+		methods = append(methods, methodRDP)
+	}
+	return methods
+}
+
+// connectMethodLabels are the menu entries for each method.
+var connectMethodLabels = map[string]string{
+	methodShell:       "SSM shell",
+	methodPortForward: "Port forward",
+	methodRDP:         fmt.Sprintf("RDP (localhost:%d)", rdpLocalPort),
+}
+
+// promptForConnectMethod asks how to connect to inst once it is selected.
+// Enter picks the SSM shell. For a port forward, the port is asked for too
+// and returned as a --port-forward value. An empty method means the user
+// chose to exit.
+func promptForConnectMethod(reader *bufio.Reader, inst *InstanceInfo) (method, forwardSpec string, err error) {
+	methods := connectMethods(inst)
+	labels := make([]string, len(methods))
+	for i, m := range methods {
+		labels[i] = fmt.Sprintf("[%d] %s", i+1, connectMethodLabels[m])
+	}
+	fmt.Printf("%s", color(fmt.Sprintf("How do you want to connect? %s. Enter for the shell: ", strings.Join(labels, " ")), qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return "", "", err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return methodShell, "", nil
+	}
+	choice := 0
+	if _, err := fmt.Sscanf(input, "%d", &choice); err != nil || choice < 1 || choice > len(methods) {
+		fmt.Println("Invalid choice. Exiting")
+		return "", "", nil
+	}
+
+	switch method = methods[choice-1]; method {
+	case methodPortForward:
+		fmt.Printf("%s", color("Port to forward (PORT or LOCAL:REMOTE): ", qc.ColorYellow))
+		input, err := readInput(reader)
+		if err != nil {
+			return "", "", err
+		}
+		forwardSpec = strings.TrimSpace(input)
+		if forwardSpec == "" {
+			fmt.Println("Exiting")
+			return "", "", nil
+		}
+		if _, _, err := parsePortForwardFlag(forwardSpec); err != nil {
+			return "", "", err
+		}
+	case methodRDP:
+		forwardSpec = fmt.Sprintf("%d:%d", rdpLocalPort, rdpRemotePort)
+	}
+	return method, forwardSpec, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// networkCrossCheckName is the name of the result correlateNetworkAndAgent
+// adds. It is not a registered check since it only reads other results.
+const networkCrossCheckName = "Network Cross-Check"
+
+// networkCheckNames are the checks that together show the instance can reach
+// SSM over the internet.
+var networkCheckNames = []string{"Internet Connectivity", "SSM Traffic Rules", "Network ACL", "VPC DNS Resolution"}
+
+// correlateNetworkAndAgent cross-checks the diagnostic results for the
+// common "it has a public IP and an internet gateway route but still won't
+// connect" case. When the instance is running with a public IP and every
+// network check passed, yet its SSM agent is not online, the network is not
+// the problem and the result points at the agent and instance role instead.
+// ok is false when the case does not apply.
+func correlateNetworkAndAgent(ctx context.Context, ssmClient *ssm.Client, instance *types.Instance, results []DiagnosticResult) (result DiagnosticResult, ok bool) {
+	status := make(map[string]string, len(results))
+	for _, r := range results {
+		status[r.CheckName] = r.Status
+	}
+	if status["Instance State"] != "PASS" || derefOr(instance.PublicIpAddress, "") == "" {
+		return DiagnosticResult{}, false
+	}
+	for _, name := range networkCheckNames {
+		if status[name] != "PASS" {
+			return DiagnosticResult{}, false
+		}
+	}
+
+	pingStatus, err := ssmPingStatus(ctx, ssmClient, derefOr(instance.InstanceId, ""))
+	if err != nil || pingStatus == string(ssmtypes.PingStatusOnline) {
+		return DiagnosticResult{}, false
+	}
+	if pingStatus == "" {
+		pingStatus = "not registered"
+	}
+
+	suspect := "the SSM agent"
+	if status["IAM Role Attachment"] != "PASS" {
+		suspect = "the instance role or the SSM agent"
+	}
+	return DiagnosticResult{
+		CheckName: networkCrossCheckName,
+		Status:    "FAIL",
+		Message: fmt.Sprintf(
+			"Network is fine (public IP %s, internet gateway route, HTTPS allowed) but SSM reports the agent as %s - the problem is %s, not networking",
+			*instance.PublicIpAddress, pingStatus, suspect,
+		),
+		Remediation: []string{
+			"# Check the agent on the instance, e.g. via EC2 Instance Connect or the serial console",
+			"# sudo systemctl status amazon-ssm-agent",
+			"# sudo tail -n 50 /var/log/amazon/ssm/amazon-ssm-agent.log",
+		},
+	}, true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// describeCredentialSource returns a human readable description of where the
+// SDK credential chain found credentials, e.g. "profile (production)" or
+// "SSO". Profile names are omitted in private mode.
+func describeCredentialSource(ctx context.Context, cfg aws.Config, privateMode bool) string {
+	if cfg.Credentials == nil {
+		return "none"
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	return friendlyCredentialSource(creds.Source, profileName(), privateMode)
+}
+
+// friendlyCredentialSource maps the SDK's aws.Credentials.Source identifiers
+// to short descriptions.
+func friendlyCredentialSource(source, profile string, privateMode bool) string {
+	withProfile := func(kind string) string {
+		if privateMode || profile == "" {
+			return kind
+		}
+		return fmt.Sprintf("%s (%s)", kind, profile)
+	}
+
+	switch {
+	case strings.HasPrefix(source, "EnvConfigCredentials"):
+		return "environment variables"
+	case strings.HasPrefix(source, "SharedConfigCredentials"):
+		return withProfile("profile")
+	case strings.HasPrefix(source, "SSOProvider"):
+		return withProfile("SSO")
+	case strings.HasPrefix(source, "AssumeRoleProvider"):
+		return withProfile("assume-role")
+	case strings.HasPrefix(source, "WebIdentityCredentials"):
+		return "web identity"
+	case strings.HasPrefix(source, "EC2RoleProvider"):
+		return "EC2 instance role"
+	case strings.HasPrefix(source, "CredentialsEndpointProvider"):
+		return "container credentials endpoint"
+	case strings.HasPrefix(source, "ProcessProvider"):
+		return withProfile("credential process")
+	case strings.HasPrefix(source, "StaticCredentials"):
+		return "static credentials"
+	case source == "":
+		return "unknown"
+	default:
+		return source
+	}
+}
+
+// profileName returns the shared config profile in use.
+func profileName() string {
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	if p := os.Getenv("AWS_DEFAULT_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+// deniedByFlagReason is the reason shown for instances denied with --deny-id.
+const deniedByFlagReason = "denied by --deny-id"
+
+// deniedInstances returns the reason each denied instance ID may not be
+// connected to: the config's deny list for account plus extraIDs from
+// --deny-id.
+func (c Config) deniedInstances(account string, extraIDs []string) map[string]string {
+	denied := map[string]string{}
+	for id, reason := range c.Deny[account] {
+		if reason == "" {
+			reason = "on the deny list"
+		}
+		denied[id] = reason
+	}
+	for _, id := range extraIDs {
+		if _, ok := denied[id]; !ok {
+			denied[id] = deniedByFlagReason
+		}
+	}
+	return denied
+}
+
+// applyDenyList marks denied instances with their reason. With hide they are
+// dropped from the list instead.
+func applyDenyList(instances []*InstanceInfo, denied map[string]string, hide bool) []*InstanceInfo {
+	if len(denied) == 0 {
+		return instances
+	}
+	kept := instances[:0]
+	for _, inst := range instances {
+		reason, ok := denied[inst.ID]
+		if !ok {
+			kept = append(kept, inst)
+			continue
+		}
+		if hide {
+			continue
+		}
+		inst.Denied = reason
+		kept = append(kept, inst)
+	}
+	return kept
+}
+
+// checkNotDenied returns an error carrying the configured reason when inst is
+// on the deny list.
+func checkNotDenied(inst *InstanceInfo) error {
+	if inst.Denied == "" {
+		return nil
+	}
+	return fmt.Errorf("refusing to connect to %s (%s): %s", inst.DisplayName, inst.ID, inst.Denied)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// describeInstance prints a formatted, read-only summary of the specified
+// instance combining EC2 metadata with its SSM registration status.
+func describeInstance(ctx context.Context, ec2Client *ec2.Client, ssmClient *ssm.Client, instanceID string) error {
+	instance, err := getInstanceDetails(ctx, ec2Client, instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to get instance details: %v", err)
+	}
+
+	fmt.Printf("\n%s\n", color(strings.Repeat("=", 60), qc.ColorBlue))
+	fmt.Printf("%s\n", colorBold("INSTANCE DETAILS: "+color(instanceID, qc.ColorWhite), qc.ColorBlue))
+	fmt.Printf("%s\n", color(strings.Repeat("=", 60), qc.ColorBlue))
+
+	state := string(instance.State.Name)
+	rows := [][2]string{
+		{"ID", instanceID},
+		{"Name", instanceTagValue(instance.Tags, "Name")},
+		{"Type", string(instance.InstanceType)},
+		{"State", color(state, colorInstState(state))},
+		{"State Reason", stateReason(instance)},
+		{"Availability Zone", placementAZ(instance)},
+		{"VPC", derefOr(instance.VpcId, "-")},
+		{"Subnet", derefOr(instance.SubnetId, "-")},
+		{"Private IPs", strings.Join(collectPrivateIPs(*instance), ", ")},
+		{"Public IP", derefOr(instance.PublicIpAddress, "-")},
+		{"IAM Profile", iamProfileArn(instance)},
+		{"SSM Status", describeSSMStatus(ctx, ssmClient, instanceID)},
+	}
+	for _, row := range rows {
+		value := row[1]
+		if value == "" {
+			value = "-"
+		}
+		fmt.Printf("  %-18s %s\n", colorBold(row[0]+":", qc.ColorCyan), value)
+	}
+
+	if len(instance.Tags) > 0 {
+		tags := append([]types.Tag{}, instance.Tags...)
+		sort.Slice(tags, func(i, j int) bool {
+			return derefOr(tags[i].Key, "") < derefOr(tags[j].Key, "")
+		})
+		fmt.Printf("  %s\n", colorBold("Tags:", qc.ColorCyan))
+		for _, tag := range tags {
+			fmt.Printf("    %s = %s\n", derefOr(tag.Key, ""), derefOr(tag.Value, ""))
+		}
+	}
+
+	return nil
+}
+
+// describeSSMStatus returns a human readable summary of the instance's SSM
+// agent registration using DescribeInstanceInformation.
+func describeSSMStatus(ctx context.Context, ssmClient *ssm.Client, instanceID string) string {
+	info, err := ssmClient.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{
+				Key:    stringPtr("InstanceIds"),
+				Values: []string{instanceID},
+			},
+		},
+	})
+	if err != nil {
+		return color(fmt.Sprintf("unknown (%v)", err), qc.ColorYellow)
+	}
+	if len(info.InstanceInformationList) == 0 {
+		return color("Not registered with SSM", qc.ColorRed)
+	}
+
+	item := info.InstanceInformationList[0]
+	status := string(item.PingStatus)
+	statusColor := qc.ColorYellow
+	if item.PingStatus == ssmtypes.PingStatusOnline {
+		statusColor = qc.ColorGreen
+	}
+	details := []string{}
+	if item.AgentVersion != nil {
+		details = append(details, "agent "+*item.AgentVersion)
+	}
+	if item.PlatformName != nil {
+		details = append(details, *item.PlatformName)
+	}
+	if item.LastPingDateTime != nil {
+		details = append(details, "last ping "+item.LastPingDateTime.Local().Format(time.RFC3339))
+	}
+	if len(details) == 0 {
+		return color(status, statusColor)
+	}
+	return fmt.Sprintf("%s (%s)", color(status, statusColor), strings.Join(details, ", "))
+}
+
+// stateReason describes why the instance is in its current state, e.g.
+// "User initiated (2024-05-01 10:00:00 GMT)" or a spot interruption.
+func stateReason(instance *types.Instance) string {
+	reason := derefOr(instance.StateTransitionReason, "")
+	if instance.StateReason != nil && instance.StateReason.Message != nil && *instance.StateReason.Message != reason {
+		if reason != "" {
+			reason += "; "
+		}
+		reason += *instance.StateReason.Message
+	}
+	return reason
+}
+
+func instanceTagValue(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if tag.Key != nil && *tag.Key == key && tag.Value != nil {
+			return *tag.Value
+		}
+	}
+	return ""
+}
+
+func placementAZ(instance *types.Instance) string {
+	if instance.Placement == nil {
+		return "-"
+	}
+	return derefOr(instance.Placement.AvailabilityZone, "-")
+}
+
+func iamProfileArn(instance *types.Instance) string {
+	if instance.IamInstanceProfile == nil {
+		return "-"
+	}
+	return derefOr(instance.IamInstanceProfile.Arn, "-")
+}
+
+func derefOr(s *string, fallback string) string {
+	if s == nil {
+		return fallback
+	}
+	return *s
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dirScopesDir is the directory within configDir holding the filters saved
+// with --remember-here, one file per working directory.
+const dirScopesDir = "directories"
+
+// rememberedFlags are the region and filter flags --remember-here saves.
+var rememberedFlags = []string{
+	"region", "filter", "lifecycle", "label-tag", "stack", "arch",
+	"exclude-tag", "owner", "resource-group", "hide-terminating", "healthy-only",
+	"ami", "launch-template", "state",
+}
+
+// DirScope is the filter set saved for a working directory.
+type DirScope struct {
+	Dir   string              `json:"dir"`   // The absolute directory, for reference
+	Flags map[string][]string `json:"flags"` // Flag name to its values, in command-line form
+}
+
+// multiValueFlag is implemented by flags whose String form cannot be passed
+// back to Set in one call, such as repeated KEY=VALUE tags.
+type multiValueFlag interface {
+	values() []string
+}
+
+func (t *tagListFlag) values() []string {
+	values := make([]string, len(*t))
+	for i, m := range *t {
+		values[i] = m.Key + "=" + m.Value
+	}
+	return values
+}
+
+// dirScopePath returns the file holding the saved filters for the current
+// directory, keyed by a hash of its absolute path.
+func dirScopePath() (path, dir string, err error) {
+	dir, err = os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", "", err
+	}
+	base, err := configDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(base, dirScopesDir, hex.EncodeToString(sum[:])+".json"), dir, nil
+}
+
+// rememberHere saves the remembered flags set on this command line for the
+// current directory and returns what was saved.
+func rememberHere(fs *flag.FlagSet) (DirScope, error) {
+	path, dir, err := dirScopePath()
+	if err != nil {
+		return DirScope{}, err
+	}
+	scope := DirScope{Dir: dir, Flags: map[string][]string{}}
+	fs.Visit(func(f *flag.Flag) {
+		if !isRememberedFlag(f.Name) {
+			return
+		}
+		if multi, ok := f.Value.(multiValueFlag); ok {
+			scope.Flags[f.Name] = multi.values()
+		} else {
+			scope.Flags[f.Name] = []string{f.Value.String()}
+		}
+	})
+	if len(scope.Flags) == 0 {
+		return scope, fmt.Errorf("--remember-here needs at least one of: --%s", strings.Join(rememberedFlags, ", --"))
+	}
+	data, err := json.MarshalIndent(scope, "", "  ")
+	if err != nil {
+		return scope, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return scope, err
+	}
+	return scope, os.WriteFile(path, data, 0o600)
+}
+
+// forgetHere removes the filters saved for the current directory. It
+// reports whether there was anything to remove.
+func forgetHere() (bool, error) {
+	path, _, err := dirScopePath()
+	if err != nil {
+		return false, err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// applyRememberedScope applies the filters saved for the current directory
+// to every remembered flag not given on the command line, and returns the
+// applied flags as "--name=value" strings for display.
+func applyRememberedScope(fs *flag.FlagSet) ([]string, error) {
+	path, _, err := dirScopePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var scope DirScope
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return nil, fmt.Errorf("invalid saved filters %s: %v", path, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	names := make([]string, 0, len(scope.Flags))
+	for name := range scope.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	applied := []string{}
+	for _, name := range names {
+		if explicit[name] || !isRememberedFlag(name) {
+			continue
+		}
+		for _, value := range scope.Flags[name] {
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid saved --%s: %v", name, err)
+			}
+			applied = append(applied, fmt.Sprintf("--%s=%s", name, value))
+		}
+	}
+	return applied, nil
+}
+
+// isRememberedFlag reports whether --remember-here saves the named flag.
+func isRememberedFlag(name string) bool {
+	for _, n := range rememberedFlags {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Built-in styles for telling apart instances that share a name. The first
+// instance always keeps the bare name.
+var duplicateNameStyles = map[string]string{
+	"paren": "%s (%d)", // web (2)
+	"hash":  "%s#%d",   // web#2
+	"dash":  "%s-%d",   // web-2
+}
+
+// duplicateNameIDStyle suffixes duplicates with the end of their instance ID,
+// e.g. web-3f9a1c, which stays stable as instances come and go.
+const duplicateNameIDStyle = "id"
+
+// duplicateIDSuffixLen is how many trailing instance ID characters the id
+// style uses.
+const duplicateIDSuffixLen = 6
+
+// duplicateNameStyle is the configured style: a built-in style name or a
+// custom format with one %d, such as " [%d]". Set from the config file.
+var duplicateNameStyle = "paren"
+
+// validateDuplicateNameStyle checks a "duplicateNames" config value.
+func validateDuplicateNameStyle(style string) error {
+	if _, ok := duplicateNameStyles[style]; ok || style == duplicateNameIDStyle {
+		return nil
+	}
+	if strings.Count(style, "%d") != 1 || strings.Count(style, "%") != 1 {
+		return fmt.Errorf("invalid duplicateNames %q: use paren, hash, dash, id, or a format with a single %%d such as \" [%%d]\"", style)
+	}
+	return nil
+}
+
+// duplicateDisplayName returns the display name for inst, the n-th (n > 1)
+// instance named inst.Name.
+func duplicateDisplayName(inst *InstanceInfo, n int) string {
+	if format, ok := duplicateNameStyles[duplicateNameStyle]; ok {
+		return fmt.Sprintf(format, inst.Name, n)
+	}
+	if duplicateNameStyle == duplicateNameIDStyle {
+		id := inst.ID
+		return inst.Name + "-" + id[max(0, len(id)-duplicateIDSuffixLen):]
+	}
+	return inst.Name + fmt.Sprintf(duplicateNameStyle, n)
+}
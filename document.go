@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// documentParameterPrefix marks a --document-name value as a reference to an
+// SSM parameter holding the document name, e.g. "ssm:/platform/session-doc".
+const documentParameterPrefix = "ssm:"
+
+// interactiveCommandDocument is the AWS-managed session document that runs a
+// single command with an interactive terminal. The session ends when the
+// command exits, so --init-command values typically end by starting a shell.
+const interactiveCommandDocument = "AWS-StartInteractiveCommand"
+
+// interactiveCommandParameters returns the JSON --parameters value that runs
+// command with interactiveCommandDocument.
+func interactiveCommandParameters(command string) (string, error) {
+	data, err := json.Marshal(map[string][]string{"command": {command}})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// resolveDocumentName returns the session document to use for name. Names
+// prefixed with documentParameterPrefix are resolved through Parameter Store
+// so orgs can manage the document centrally; others are returned unchanged.
+func resolveDocumentName(ctx context.Context, ssmClient *ssm.Client, name string) (string, error) {
+	paramName, ok := strings.CutPrefix(name, documentParameterPrefix)
+	if !ok {
+		return name, nil
+	}
+	if paramName == "" {
+		return "", fmt.Errorf("--document-name %q is missing a parameter name", name)
+	}
+
+	output, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           &paramName,
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("SSM parameter %s not found (referenced by --document-name)", paramName)
+		}
+		return "", fmt.Errorf("failed to read SSM parameter %s: %v", paramName, wrapAccessDenied(err, "ssm:GetParameter"))
+	}
+	if output.Parameter == nil || strings.TrimSpace(derefOr(output.Parameter.Value, "")) == "" {
+		return "", fmt.Errorf("SSM parameter %s is empty (referenced by --document-name)", paramName)
+	}
+	return strings.TrimSpace(*output.Parameter.Value), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// caBundleEnv is the environment variable both the SDK and the aws CLI read
+// a custom CA bundle from.
+const caBundleEnv = "AWS_CA_BUNDLE"
+
+// validateEndpointURL checks that an --endpoint-url value is an absolute
+// http(s) URL, e.g. http://localhost:4566 for LocalStack.
+func validateEndpointURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint URL %q: expected http(s)://host[:port]", endpoint)
+	}
+	return nil
+}
+
+// awsConfigOptions returns the config.LoadDefaultConfig options for the
+// region, a custom endpoint, and a CA bundle. When caBundle is empty the SDK
+// falls back to AWS_CA_BUNDLE on its own, so the variable is only checked
+// here to fail with a clearer message than the SDK's TLS errors.
+func awsConfigOptions(region, endpointURL, caBundle string) ([]func(*config.LoadOptions) error, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if endpointURL != "" {
+		if err := validateEndpointURL(endpointURL); err != nil {
+			return nil, err
+		}
+		opts = append(opts, config.WithBaseEndpoint(endpointURL))
+	}
+	if caBundle != "" {
+		data, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		opts = append(opts, config.WithCustomCABundle(bytes.NewReader(data)))
+	} else if envBundle := os.Getenv(caBundleEnv); envBundle != "" {
+		if _, err := os.Stat(envBundle); err != nil {
+			return nil, fmt.Errorf("%s is set but unreadable: %v", caBundleEnv, err)
+		}
+	}
+	return opts, nil
+}
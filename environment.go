@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// Environment names recognized in the "environments" config section.
+const (
+	envProd    = "prod"
+	envStaging = "staging"
+	envDev     = "dev"
+)
+
+// defaultEnvironmentColors maps each environment to its header color.
+var defaultEnvironmentColors = map[string]string{
+	envProd:    qc.ColorRed,
+	envStaging: qc.ColorYellow,
+	envDev:     qc.ColorGreen,
+}
+
+// environmentColorNames are the color names accepted in "environmentColors".
+var environmentColorNames = map[string]string{
+	"red":    qc.ColorRed,
+	"yellow": qc.ColorYellow,
+	"green":  qc.ColorGreen,
+	"blue":   qc.ColorBlue,
+	"cyan":   qc.ColorCyan,
+	"purple": qc.ColorPurple,
+	"white":  qc.ColorWhite,
+}
+
+// environmentPrecedence orders the built-in environments, most cautious
+// first, for accounts listed under several of them.
+var environmentPrecedence = []string{envProd, envStaging, envDev}
+
+// environmentNames returns the configured environment names in precedence
+// order: the built-ins first, then the rest alphabetically.
+func (c Config) environmentNames() []string {
+	rank := func(name string) int {
+		for i, n := range environmentPrecedence {
+			if n == name {
+				return i
+			}
+		}
+		return len(environmentPrecedence)
+	}
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := rank(names[i]), rank(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// environmentFor returns the environment the account and region belong to,
+// or "" when unclassified. Entries are account IDs or ACCOUNT:REGION pairs;
+// a region-specific entry wins over a plain account entry. When several
+// environments match equally, the first in environmentNames order wins, so
+// the result is the same on every run.
+func (c Config) environmentFor(account, region string) string {
+	env := ""
+	for _, name := range c.environmentNames() {
+		for _, entry := range c.Environments[name] {
+			switch entry {
+			case account + ":" + region:
+				return name
+			case account:
+				if env == "" {
+					env = name
+				}
+			}
+		}
+	}
+	return env
+}
+
+// environmentColor returns the header color for env, honoring any
+// "environmentColors" overrides.
+func (c Config) environmentColor(env string) (string, error) {
+	if name, ok := c.EnvironmentColors[env]; ok {
+		code, ok := environmentColorNames[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("unknown color %q for environment %q", name, env)
+		}
+		return code, nil
+	}
+	if code, ok := defaultEnvironmentColors[env]; ok {
+		return code, nil
+	}
+	return qc.ColorBlue, nil
+}
+
+// environmentBanner returns the line printed in the header for env.
+// Production gets a bold warning so it is hard to miss.
+func environmentBanner(env, code string) string {
+	if env == envProd {
+		return colorBold("  !!! PRODUCTION ACCOUNT !!!", code)
+	}
+	return colorBold("  Environment: "+env, code)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestEnvironmentFor(t *testing.T) {
+	config := Config{Environments: map[string][]string{
+		envProd:    {"111111111111", "333333333333"},
+		envStaging: {"222222222222", "333333333333"},
+		envDev:     {"222222222222:eu-west-1"},
+		"sandbox":  {"444444444444"},
+		"lab":      {"444444444444"},
+	}}
+	tests := []struct {
+		account, region string
+		want            string
+	}{
+		{account: "111111111111", region: "us-east-1", want: envProd},
+		{account: "222222222222", region: "us-east-1", want: envStaging},
+		// A region-specific entry wins over a plain account entry.
+		{account: "222222222222", region: "eu-west-1", want: envDev},
+		// Built-in environments win in precedence order, then alphabetically.
+		{account: "333333333333", region: "us-east-1", want: envProd},
+		{account: "444444444444", region: "us-east-1", want: "lab"},
+		{account: "999999999999", region: "us-east-1", want: ""},
+	}
+	for _, tt := range tests {
+		for range 10 {
+			if got := config.environmentFor(tt.account, tt.region); got != tt.want {
+				t.Errorf("environmentFor(%s, %s) = %q, want %q", tt.account, tt.region, got, tt.want)
+				break
+			}
+		}
+	}
+}
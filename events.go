@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventSinkTimeout bounds how long an HTTP event sink may take per event.
+const eventSinkTimeout = 5 * time.Second
+
+// ConnectEvent is the structured event emitted to --event-sink for each
+// session or port forward, for audit and SIEM pipelines.
+type ConnectEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"` // Always "connect"
+	User       string    `json:"user,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	InstanceID string    `json:"instanceId"`
+	Name       string    `json:"name,omitempty"`
+	Mode       string    `json:"mode"` // "session" or "port-forward"
+	Ticket     string    `json:"ticket,omitempty"`
+	Version    string    `json:"version"`
+}
+
+// EventSink delivers connect events to a JSON-lines file or an HTTP endpoint.
+// Delivery happens in the background so a slow sink never delays connecting.
+type EventSink struct {
+	target string
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// connectionEvents is the sink configured with --event-sink, or nil.
+var connectionEvents *EventSink
+
+// newEventSink returns a sink for target, which is either an http(s) URL
+// that events are POSTed to or a file path that events are appended to.
+func newEventSink(target string) *EventSink {
+	return &EventSink{target: target, client: &http.Client{Timeout: eventSinkTimeout}}
+}
+
+// isHTTP reports whether the sink posts to a URL rather than writing a file.
+func (s *EventSink) isHTTP() bool {
+	return strings.HasPrefix(s.target, "http://") || strings.HasPrefix(s.target, "https://")
+}
+
+// emit sends event in the background. Failures only produce a warning.
+func (s *EventSink) emit(event ConnectEvent) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("[WARNING]: could not encode event:", err)
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.deliver(data); err != nil {
+			log.Println("[WARNING]: could not deliver event to --event-sink:", err)
+		}
+	}()
+}
+
+func (s *EventSink) deliver(data []byte) error {
+	if s.isHTTP() {
+		resp, err := s.client.Post(s.target, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s returned %s", s.target, resp.Status)
+		}
+		return nil
+	}
+	f, err := os.OpenFile(s.target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// wait gives in-flight events up to timeout to be delivered before exit.
+func (s *EventSink) wait(timeout time.Duration) {
+	if s == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// explainDiagnostics turns individual diagnostic results into a short
+// narrative of how the instance is expected to reach SSM. It relies only on
+// the results, so checks that were skipped are simply not mentioned.
+func explainDiagnostics(results []DiagnosticResult) []string {
+	status := make(map[string]string, len(results))
+	for _, result := range results {
+		status[result.CheckName] = result.Status
+	}
+
+	var lines []string
+	switch status["Instance State"] {
+	case "FAIL":
+		lines = append(lines, "The instance is not running, so the SSM agent cannot be reached at all.")
+	case "WARN":
+		lines = append(lines, "The instance is not fully running yet; the SSM agent may still be starting.")
+	}
+
+	switch status["Internet Connectivity"] {
+	case "PASS":
+		lines = append(lines, "It reaches the SSM endpoints through its subnet's internet gateway.")
+	case "FAIL":
+		lines = append(lines, "Its subnet has no internet gateway route, so it must reach SSM through a NAT gateway or SSM VPC endpoints.")
+	case "WARN":
+		lines = append(lines, "Its network path to the SSM endpoints could not be determined.")
+	}
+
+	switch status["VPC DNS Resolution"] {
+	case "FAIL":
+		lines = append(lines, "The VPC cannot resolve DNS, so the agent cannot find the SSM endpoints.")
+	case "WARN":
+		lines = append(lines, "Private DNS for SSM VPC endpoints may not resolve in this VPC.")
+	}
+
+	switch status["SSM Traffic Rules"] {
+	case "PASS":
+		lines = append(lines, "Its security groups allow the outbound HTTPS (443) traffic the agent uses.")
+	case "FAIL":
+		lines = append(lines, "Its security groups block the outbound HTTPS (443) traffic the agent uses.")
+	}
+
+	if status["Network ACL"] == "FAIL" {
+		lines = append(lines, "Its subnet's network ACL blocks the HTTPS traffic or the return traffic the agent relies on.")
+	}
+
+	switch status["IAM Role Attachment"] {
+	case "PASS":
+		lines = append(lines, "It has an instance role with the permissions the agent needs to register with SSM.")
+	case "FAIL":
+		lines = append(lines, "Without an instance role granting SSM permissions, the agent cannot register with SSM.")
+	case "WARN":
+		lines = append(lines, "Its instance role's SSM permissions could not be fully verified.")
+	}
+
+	if status["SSM Agent Registration"] == "WARN" {
+		lines = append(lines, "Its SSM agent may be registered under another ID, so SSM may not recognize it as this instance.")
+	}
+
+	if status[networkCrossCheckName] == "FAIL" {
+		lines = append(lines, "Since its network path is fine but the agent is not online, look at the agent and the instance role rather than networking.")
+	}
+
+	_, warnCount, failCount := countResults(results)
+	switch {
+	case failCount > 0:
+		lines = append(lines, "Fix the failed items above before connecting.")
+	case warnCount > 0:
+		lines = append(lines, "You should be able to connect, but the warnings above may get in the way.")
+	default:
+		lines = append(lines, "You should be able to connect.")
+	}
+	return lines
+}
+
+// printExplanation prints the explainDiagnostics narrative as a footer.
+func printExplanation(results []DiagnosticResult) {
+	fmt.Printf("\n%s\n", colorBold("How this instance connects to SSM", qc.ColorCyan))
+	fmt.Println(strings.Join(explainDiagnostics(results), " "))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// InstanceRecord is the machine-readable representation of an instance used
+// by the --csv and --json outputs.
+type InstanceRecord struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Type      string `json:"type"`
+	AZ        string `json:"availabilityZone"`
+	PrivateIP string `json:"privateIp"`
+	SSMStatus string `json:"ssmStatus"`
+}
+
+// csvHeader lists the --csv columns in order.
+var csvHeader = []string{"ID", "Name", "State", "Type", "AZ", "PrivateIP", "SSMStatus"}
+
+// newInstanceRecord builds the export record for inst. Instances unknown to
+// SSM are reported as "NotRegistered".
+func newInstanceRecord(inst *InstanceInfo) InstanceRecord {
+	record := InstanceRecord{
+		ID:        inst.ID,
+		Name:      inst.Name,
+		State:     inst.State,
+		Type:      inst.Type,
+		AZ:        inst.AZ,
+		SSMStatus: inst.PingStatus,
+	}
+	if len(inst.PrivateIPs) > 0 {
+		record.PrivateIP = inst.PrivateIPs[0]
+	}
+	if record.SSMStatus == "" {
+		record.SSMStatus = "NotRegistered"
+	}
+	return record
+}
+
+// writeInstancesCSV writes the instances as CSV with a header row.
+func writeInstancesCSV(w io.Writer, instances []*InstanceInfo) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, inst := range instances {
+		r := newInstanceRecord(inst)
+		if err := cw.Write([]string{r.ID, r.Name, r.State, r.Type, r.AZ, r.PrivateIP, r.SSMStatus}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonSchemaVersion is included as "schemaVersion" in every JSON output. It
+// is only bumped for breaking changes (removed or renamed fields, changed
+// types); new fields may be added without a bump.
+const jsonSchemaVersion = 1
+
+// instanceListJSON is the --json format of the instance list.
+type instanceListJSON struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Instances     []InstanceRecord `json:"instances"`
+}
+
+// diagnosticsJSON is the --json format of --check results for one instance.
+type diagnosticsJSON struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Instance      InstanceRecord     `json:"instance"`
+	Results       []DiagnosticResult `json:"results"`
+}
+
+// checkAllJSON is the --json format of --check-all results.
+type checkAllJSON struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	Instances     []instanceCheckJSON `json:"instances"`
+}
+
+// instanceCheckJSON is one instance's entry in checkAllJSON.
+type instanceCheckJSON struct {
+	Instance InstanceRecord     `json:"instance"`
+	VpcID    string             `json:"vpcId,omitempty"`
+	SubnetID string             `json:"subnetId,omitempty"`
+	Results  []DiagnosticResult `json:"results"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeInstancesJSON writes the instance list as JSON.
+func writeInstancesJSON(w io.Writer, instances []*InstanceInfo) error {
+	records := make([]InstanceRecord, len(instances))
+	for i, inst := range instances {
+		records[i] = newInstanceRecord(inst)
+	}
+	return writeJSON(w, instanceListJSON{SchemaVersion: jsonSchemaVersion, Instances: records})
+}
+
+// writeDiagnosticsJSON writes the diagnostic results for inst as JSON.
+func writeDiagnosticsJSON(w io.Writer, inst *InstanceInfo, results []DiagnosticResult) error {
+	return writeJSON(w, diagnosticsJSON{
+		SchemaVersion: jsonSchemaVersion,
+		Instance:      newInstanceRecord(inst),
+		Results:       nonNilResults(results),
+	})
+}
+
+// writeCheckAllJSON writes --check-all results as JSON.
+func writeCheckAllJSON(w io.Writer, checks []InstanceCheck) error {
+	out := checkAllJSON{SchemaVersion: jsonSchemaVersion, Instances: make([]instanceCheckJSON, len(checks))}
+	for i, check := range checks {
+		out.Instances[i] = instanceCheckJSON{
+			Instance: newInstanceRecord(check.Instance),
+			VpcID:    check.VpcID,
+			SubnetID: check.SubnetID,
+			Results:  nonNilResults(check.Results),
+		}
+		if check.Err != nil {
+			out.Instances[i].Error = check.Err.Error()
+		}
+	}
+	return writeJSON(w, out)
+}
+
+// nonNilResults makes empty result lists encode as [] rather than null.
+func nonNilResults(results []DiagnosticResult) []DiagnosticResult {
+	if results == nil {
+		return []DiagnosticResult{}
+	}
+	return results
+}
+
+// porcelainFieldReplacer keeps --porcelain fields on one tab-separated line.
+var porcelainFieldReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// writeInstancesPorcelain writes one line per instance with the tab-separated
+// columns index, id, name, state. The index matches the menu number. This
+// format is a stability guarantee for scripts: columns are never reordered
+// or removed, and any new columns will only be appended.
+func writeInstancesPorcelain(w io.Writer, instances []*InstanceInfo) error {
+	for i, inst := range instances {
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+			i+1, inst.ID, porcelainFieldReplacer.Replace(inst.DisplayName), inst.State,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
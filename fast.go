@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// validateFastFilter reports filters that --fast cannot honor, since
+// DescribeInstanceStatus does not return architecture, lifecycle, or the
+// owning account and does not accept the DescribeInstances filters.
+func validateFastFilter(filter InstanceFilter) error {
+	switch {
+	case filter.Arch != "":
+		return fmt.Errorf("--fast cannot be combined with --arch")
+	case filter.Lifecycle != "all":
+		return fmt.Errorf("--fast cannot be combined with --lifecycle")
+	case len(filter.AMIs) > 0:
+		return fmt.Errorf("--fast cannot be combined with --ami")
+	case filter.LaunchTemplate != "":
+		return fmt.Errorf("--fast cannot be combined with --launch-template")
+	case len(filter.APIFilters) > 0 || len(filter.InstanceIDs) > 0:
+		return fmt.Errorf("--fast cannot be combined with --resource-group")
+	case filter.Owner != "":
+		return fmt.Errorf("--fast cannot be combined with --owner")
+	}
+	return nil
+}
+
+// getInstancesFast lists instances using DescribeInstanceStatus for states
+// and DescribeTags for names instead of paginating full DescribeInstances
+// output. The result carries only ID, name, state, availability zone, and
+// tags; type, architecture, lifecycle, platform, private IPs, and owner are
+// left empty, which is why validateFastFilter rejects an owner filter.
+func getInstancesFast(ctx context.Context, ec2Client *ec2.Client, filter InstanceFilter) ([]*InstanceInfo, error) {
+	if err := validateFastFilter(filter); err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*InstanceInfo{}
+	var order []string
+	statusInput := &ec2.DescribeInstanceStatusInput{
+		IncludeAllInstances: aws.Bool(true),
+	}
+	if len(filter.States) > 0 {
+		statusInput.Filters = []types.Filter{{Name: stringPtr("instance-state-name"), Values: filter.States}}
+	}
+	statusPaginator := ec2.NewDescribeInstanceStatusPaginator(ec2Client, statusInput)
+	for statusPaginator.HasMorePages() {
+		output, err := statusPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, status := range output.InstanceStatuses {
+			if status.InstanceId == nil {
+				continue
+			}
+			inst := &InstanceInfo{
+				ID:   *status.InstanceId,
+				AZ:   derefOr(status.AvailabilityZone, ""),
+				Tags: map[string]string{},
+			}
+			if status.InstanceState != nil {
+				inst.State = string(status.InstanceState.Name)
+			}
+			if inst.State == "running" {
+				inst.Health = instanceHealth(status)
+			}
+			byID[inst.ID] = inst
+			order = append(order, inst.ID)
+		}
+	}
+
+	tagPaginator := ec2.NewDescribeTagsPaginator(ec2Client, &ec2.DescribeTagsInput{
+		Filters: []types.Filter{
+			{Name: stringPtr("resource-type"), Values: []string{"instance"}},
+		},
+	})
+	for tagPaginator.HasMorePages() {
+		output, err := tagPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range output.Tags {
+			if tag.ResourceId == nil || tag.Key == nil || tag.Value == nil {
+				continue
+			}
+			if inst, ok := byID[*tag.ResourceId]; ok {
+				inst.Tags[*tag.Key] = *tag.Value
+			}
+		}
+	}
+
+	var instances []*InstanceInfo
+	for _, id := range order {
+		inst := byID[id]
+		inst.Name = "unknown"
+		// Prefer the configured label tag, falling back to "Name"
+		if name, ok := inst.Tags[filter.LabelTag]; ok && filter.LabelTag != "" {
+			inst.Name = name
+		} else if name, ok := inst.Tags["Name"]; ok {
+			inst.Name = name
+		}
+		if filter.Name != "" && !strings.Contains(strings.ToLower(inst.Name), strings.ToLower(filter.Name)) {
+			continue
+		}
+		if filter.Stack != "" && inst.Tags[cfnStackTag] != filter.Stack {
+			continue
+		}
+		if filter.HideTerminating && isTransitioningOut(inst.State) {
+			continue
+		}
+		if matchesAnyTag(inst.Tags, filter.ExcludeTags) {
+			continue
+		}
+		instances = append(instances, inst)
+	}
+	sortInstances(instances, sortByName)
+	addInstanceDisplayNames(instances)
+
+	return instances, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// ssmInterfaceEndpoints are the VPC interface endpoints SSM requires when an
+// instance has no route to the internet.
+var ssmInterfaceEndpoints = []string{"ssm", "ssmmessages", "ec2messages"}
+
+// ssmEndpointCommands returns the commands that create the SSM interface
+// endpoints in the instance's VPC so SSM works without internet access.
+func ssmEndpointCommands(region, vpcID, subnetID string, groups []types.GroupIdentifier) []string {
+	if region == "" {
+		region = "REGION"
+	}
+	sgArgs := ""
+	ids := []string{}
+	for _, g := range groups {
+		if g.GroupId != nil {
+			ids = append(ids, *g.GroupId)
+		}
+	}
+	if len(ids) > 0 {
+		sgArgs = " --security-group-ids " + strings.Join(ids, " ")
+	}
+	commands := []string{"# Alternatively, add a NAT or internet gateway route for the subnet"}
+	for _, svc := range ssmInterfaceEndpoints {
+		commands = append(commands, fmt.Sprintf(
+			"aws ec2 create-vpc-endpoint --vpc-id %s --vpc-endpoint-type Interface --service-name com.amazonaws.%s.%s --subnet-ids %s%s --private-dns-enabled",
+			vpcID, region, svc, subnetID, sgArgs,
+		))
+	}
+	return commands
+}
+
+// writeFixScript writes a reviewable shell script containing the remediation
+// commands for every failed check in results. Nothing is executed. It reports
+// whether a script was written; no file is created when nothing is fixable.
+func writeFixScript(path, instanceID, region string, results []DiagnosticResult) (bool, error) {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Remediation script for %s generated by quick_ssm on %s.\n", instanceID, time.Now().Format(time.RFC3339))
+	b.WriteString("# Review every command before running it.\n")
+	b.WriteString("set -e\n")
+	if region != "" {
+		fmt.Fprintf(&b, "export AWS_REGION=%s\n", region)
+	}
+
+	fixes := 0
+	for _, result := range results {
+		if result.Status != "FAIL" || len(result.Remediation) == 0 {
+			continue
+		}
+		fixes++
+		fmt.Fprintf(&b, "\n# Fixes %s: %s\n", result.CheckName, result.Message)
+		for _, cmd := range result.Remediation {
+			b.WriteString(cmd + "\n")
+		}
+	}
+	if fixes == 0 {
+		return false, nil
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0o755); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reportFixScript writes the remediation script for results to path and
+// tells the user whether anything was written.
+func reportFixScript(path, instanceID, region string, results []DiagnosticResult) {
+	written, err := writeFixScript(path, instanceID, region, results)
+	if err != nil {
+		log.Fatal("Failed to write fix script:", err)
+	}
+	if written {
+		fmt.Printf("\nRemediation script written to %s. Review it before running.\n", colorBold(path, qc.ColorCyan))
+	} else {
+		fmt.Println("\nNo fixable failures found; no remediation script written.")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Health summaries derived from EC2 system and instance status checks.
+const (
+	healthOK         = "ok"
+	healthImpaired   = "impaired"
+	healthInProgress = "initializing"
+)
+
+// instanceHealth summarizes an instance's status checks: impaired if either
+// check is impaired, ok if both are ok, and initializing otherwise.
+func instanceHealth(status types.InstanceStatus) string {
+	system, instance := types.SummaryStatus(""), types.SummaryStatus("")
+	if status.SystemStatus != nil {
+		system = status.SystemStatus.Status
+	}
+	if status.InstanceStatus != nil {
+		instance = status.InstanceStatus.Status
+	}
+	switch {
+	case system == types.SummaryStatusImpaired || instance == types.SummaryStatusImpaired:
+		return healthImpaired
+	case system == types.SummaryStatusOk && instance == types.SummaryStatusOk:
+		return healthOK
+	default:
+		return healthInProgress
+	}
+}
+
+// instanceStatusIDLimit is the most instance IDs DescribeInstanceStatus
+// accepts in one call.
+const instanceStatusIDLimit = 100
+
+// loadInstanceHealth populates Health for running instances with
+// DescribeInstanceStatus, asking only about the given instances so a short
+// list, such as --target candidates, does not page through the account.
+// Instances that are not running have no status checks and are left blank.
+func loadInstanceHealth(ctx context.Context, ec2Client *ec2.Client, instances []*InstanceInfo) error {
+	byID := make(map[string]*InstanceInfo, len(instances))
+	ids := []string{}
+	for _, inst := range instances {
+		if inst.State == "running" {
+			byID[inst.ID] = inst
+			ids = append(ids, inst.ID)
+		}
+	}
+
+	for start := 0; start < len(ids); start += instanceStatusIDLimit {
+		output, err := ec2Client.DescribeInstanceStatus(ctx, &ec2.DescribeInstanceStatusInput{
+			InstanceIds: ids[start:min(start+instanceStatusIDLimit, len(ids))],
+		})
+		if err != nil {
+			return err
+		}
+		for _, status := range output.InstanceStatuses {
+			if status.InstanceId == nil {
+				continue
+			}
+			if inst, ok := byID[*status.InstanceId]; ok {
+				inst.Health = instanceHealth(status)
+			}
+		}
+	}
+	return nil
+}
+
+// filterHealthy returns the instances whose status checks are all ok.
+func filterHealthy(instances []*InstanceInfo) []*InstanceInfo {
+	var healthy []*InstanceInfo
+	for _, inst := range instances {
+		if inst.Health == healthOK {
+			healthy = append(healthy, inst)
+		}
+	}
+	return healthy
+}
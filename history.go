@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	versionpkg "github.com/bevelwork/quick_ssm/version"
+)
+
+// historyFile is the name of the session history log within configDir. Each
+// line is one JSON-encoded HistoryEntry.
+const historyFile = "history.jsonl"
+
+// HistoryEntry records a session started by quick_ssm.
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	InstanceID string    `json:"instanceId"`
+	Name       string    `json:"name,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	Mode       string    `json:"mode"` // "session" or "port-forward"
+	Ticket     string    `json:"ticket,omitempty"`
+}
+
+// configDir returns the directory quick_ssm uses for persistent state,
+// creating it if necessary.
+func configDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "quick_ssm")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// appendHistory adds entry to the history log.
+func appendHistory(entry HistoryEntry) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ticketPattern accepts identifier-shaped ticket references such as
+// "OPS-1234", "#5678", or "INC0012345".
+var ticketPattern = regexp.MustCompile(`^#?[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// validateTicket checks that a --ticket value looks like a ticket identifier.
+func validateTicket(ticket string) error {
+	if !ticketPattern.MatchString(ticket) {
+		return fmt.Errorf("invalid ticket %q: use an identifier such as OPS-1234 or #5678", ticket)
+	}
+	return nil
+}
+
+// recordSession appends a history entry for a session about to start and
+// emits it to the --event-sink, if any. Both are best-effort, so failures
+// only produce a warning.
+func recordSession(instance *InstanceInfo, region string, callerIdentity *sts.GetCallerIdentityOutput, mode, ticket string, privateMode bool) {
+	entry := HistoryEntry{
+		Time:       time.Now().UTC(),
+		InstanceID: instance.ID,
+		Name:       instance.Name,
+		Region:     region,
+		Mode:       mode,
+		Ticket:     ticket,
+	}
+	if !privateMode && callerIdentity.Account != nil {
+		entry.Account = *callerIdentity.Account
+	}
+	if err := appendHistory(entry); err != nil {
+		log.Println("[WARNING]: could not record session history:", err)
+	}
+
+	event := ConnectEvent{
+		Time:       entry.Time,
+		Event:      "connect",
+		Account:    entry.Account,
+		Region:     region,
+		InstanceID: instance.ID,
+		Name:       instance.Name,
+		Mode:       mode,
+		Ticket:     ticket,
+		Version:    versionpkg.Full,
+	}
+	if !privateMode {
+		event.User = derefOr(callerIdentity.Arn, "")
+	}
+	connectionEvents.emit(event)
+}
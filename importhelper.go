@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// terraformNameInvalid matches characters not allowed in a Terraform
+// resource name.
+var terraformNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// terraformResourceName derives a Terraform resource name from the instance
+// name, falling back to the instance ID.
+func terraformResourceName(inst *InstanceInfo) string {
+	name := strings.Trim(terraformNameInvalid.ReplaceAllString(strings.ToLower(inst.Name), "_"), "_-")
+	if name == "" {
+		name = strings.ReplaceAll(inst.ID, "-", "_")
+	}
+	// Resource names must start with a letter or underscore.
+	if name[0] >= '0' && name[0] <= '9' || name[0] == '-' {
+		name = "_" + name
+	}
+	return name
+}
+
+// printImportHelpers prints the commands for bringing inst under
+// infrastructure-as-code management: a Terraform import command and block,
+// and the aws CLI call that shows the attributes to fill in.
+func printImportHelpers(inst *InstanceInfo, region string) {
+	resource := "aws_instance." + terraformResourceName(inst)
+	fmt.Println("# Terraform")
+	fmt.Printf("terraform import %s %s\n", resource, inst.ID)
+	fmt.Println()
+	fmt.Println("# Terraform 1.5+ import block")
+	fmt.Printf("import {\n  to = %s\n  id = %q\n}\n", resource, inst.ID)
+	fmt.Println()
+	fmt.Println("# Current configuration")
+	fmt.Printf("aws ec2 describe-instances --instance-ids %s --region %s\n", inst.ID, region)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shellSafe matches arguments that need no quoting in a POSIX shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes arg for pasting into a POSIX shell.
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// ForwardInstructions describes the port forward --instructions explains;
+// nil instructions are for an interactive session.
+type ForwardInstructions struct {
+	LocalPort  int
+	RemotePort int
+	RemoteHost string // Forward through the instance to this host, if set
+	RDP        bool
+}
+
+// printConnectInstructions prints, as copy-paste guidance with comments,
+// the commands someone else would run to connect or tunnel to inst. Nothing
+// is executed. account may be empty, e.g. in private mode.
+func printConnectInstructions(inst *InstanceInfo, region, account string, opts SessionOptions, forward *ForwardInstructions) {
+	var args []string
+	if forward != nil {
+		args = opts.portForwardArgs(inst.ID, forward.LocalPort, forward.RemotePort, forward.RemoteHost)
+	} else {
+		args = opts.sessionArgs(inst.ID)
+	}
+	if opts.Region == "" {
+		args = append(args, "--region", region)
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+
+	fmt.Printf("# Connect to %s (%s) in %s\n", inst.DisplayName, inst.ID, region)
+	fmt.Println("#")
+	fmt.Println("# 1. Install the AWS CLI v2 and the Session Manager plugin:")
+	fmt.Println("#    " + sessionManagerPluginInstallURL)
+	if account != "" {
+		fmt.Printf("# 2. Sign in to account %s with credentials allowed ssm:StartSession on the instance.\n", account)
+	} else {
+		fmt.Println("# 2. Sign in with credentials allowed ssm:StartSession on the instance.")
+	}
+	fmt.Println("#    Check with: aws sts get-caller-identity")
+	switch {
+	case forward == nil:
+		fmt.Println("# 3. Start a shell on the instance. Type exit to end the session.")
+	case forward.RemoteHost != "":
+		fmt.Printf("# 3. Forward localhost:%d through the instance to %s:%d. Leave this running and\n", forward.LocalPort, forward.RemoteHost, forward.RemotePort)
+		fmt.Printf("#    connect to localhost:%d from another terminal. Press Ctrl-C to close the tunnel.\n", forward.LocalPort)
+	default:
+		fmt.Printf("# 3. Forward localhost:%d to port %d on the instance. Leave this running and\n", forward.LocalPort, forward.RemotePort)
+		fmt.Printf("#    connect to localhost:%d from another terminal. Press Ctrl-C to close the tunnel.\n", forward.LocalPort)
+	}
+	if forward != nil && forward.RDP {
+		fmt.Printf("#    Point your RDP client at localhost:%d.\n", forward.LocalPort)
+	}
+	fmt.Println("aws " + strings.Join(quoted, " "))
+}
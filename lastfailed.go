@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lastFailedFile is the name of the state file within configDir that records
+// the most recent failed connection for --diagnose-last.
+const lastFailedFile = "last-failed.json"
+
+// lastFailedConnection is the on-disk format of lastFailedFile.
+type lastFailedConnection struct {
+	InstanceID string    `json:"instanceId"`
+	Region     string    `json:"region"`
+	Time       time.Time `json:"time"`
+}
+
+// recordFailedConnection remembers instanceID so --diagnose-last can revisit
+// it in a later run. Failures only produce a warning.
+func recordFailedConnection(instanceID, region string) {
+	err := func() error {
+		dir, err := configDir()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(lastFailedConnection{InstanceID: instanceID, Region: region, Time: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, lastFailedFile), data, 0o600)
+	}()
+	if err != nil {
+		log.Println("[WARNING]: could not record failed connection:", err)
+	}
+}
+
+// loadFailedConnection returns the most recently recorded failed connection.
+func loadFailedConnection() (lastFailedConnection, error) {
+	var last lastFailedConnection
+	dir, err := configDir()
+	if err != nil {
+		return last, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, lastFailedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return last, fmt.Errorf("no failed connection has been recorded yet")
+	}
+	if err != nil {
+		return last, err
+	}
+	if err := json.Unmarshal(data, &last); err != nil || last.InstanceID == "" {
+		return last, fmt.Errorf("corrupt %s; connect again to replace it", lastFailedFile)
+	}
+	return last, nil
+}
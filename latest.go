@@ -0,0 +1,21 @@
+package main
+
+import "time"
+
+// latestLaunched returns the instances with the newest launch time. More
+// than one is returned only when several share that exact launch time, such
+// as instances started by the same RunInstances call.
+func latestLaunched(instances []*InstanceInfo) []*InstanceInfo {
+	var newest time.Time
+	latest := []*InstanceInfo{}
+	for _, inst := range instances {
+		switch {
+		case inst.LaunchTime.After(newest):
+			newest = inst.LaunchTime
+			latest = []*InstanceInfo{inst}
+		case inst.LaunchTime.Equal(newest) && !newest.IsZero():
+			latest = append(latest, inst)
+		}
+	}
+	return latest
+}
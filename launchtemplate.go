@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// EC2 tags instances launched from a launch template with the template's ID
+// and version.
+const (
+	launchTemplateIDTag      = "aws:ec2launchtemplate:id"
+	launchTemplateVersionTag = "aws:ec2launchtemplate:version"
+)
+
+// resolveLaunchTemplate parses a --launch-template value, a template ID or
+// name with an optional ":VERSION" suffix, and returns the template ID and
+// version. Names are looked up with DescribeLaunchTemplates.
+func resolveLaunchTemplate(ctx context.Context, ec2Client *ec2.Client, value string) (id, version string, err error) {
+	nameOrID, version, _ := strings.Cut(strings.TrimSpace(value), ":")
+	if nameOrID == "" {
+		return "", "", fmt.Errorf("invalid --launch-template %q: expected ID or NAME, optionally followed by :VERSION", value)
+	}
+	if strings.HasPrefix(nameOrID, "lt-") {
+		return nameOrID, version, nil
+	}
+	output, err := ec2Client.DescribeLaunchTemplates(ctx, &ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateNames: []string{nameOrID},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up launch template %q: %v", nameOrID, wrapAccessDenied(err, "ec2:DescribeLaunchTemplates"))
+	}
+	if len(output.LaunchTemplates) == 0 {
+		return "", "", fmt.Errorf("no launch template named %q", nameOrID)
+	}
+	return derefOr(output.LaunchTemplates[0].LaunchTemplateId, ""), version, nil
+}
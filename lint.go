@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// instancesMissingName returns the instances without a non-empty Name tag.
+func instancesMissingName(instances []*InstanceInfo) []*InstanceInfo {
+	missing := []*InstanceInfo{}
+	for _, inst := range instances {
+		if strings.TrimSpace(inst.Tags["Name"]) == "" {
+			missing = append(missing, inst)
+		}
+	}
+	return missing
+}
+
+// printLintReport prints fleet hygiene findings for the listed instances.
+// It returns true when no issues were found.
+func printLintReport(instances []*InstanceInfo) bool {
+	fmt.Printf("\n%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
+	fmt.Printf("%s\n", colorBold("FLEET LINT", qc.ColorPurple))
+	fmt.Printf("%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
+
+	missing := instancesMissingName(instances)
+	if len(missing) == 0 {
+		fmt.Printf("✅ %s: all %d instances have a Name tag\n", colorBold("Name Tag", qc.ColorGreen), len(instances))
+		return true
+	}
+
+	fmt.Printf("⚠️  %s: %d of %d instances have no Name tag\n", colorBold("Name Tag", qc.ColorYellow), len(missing), len(instances))
+	for _, inst := range missing {
+		fmt.Printf("    %s [%s]\n", inst.ID, color(inst.State, colorInstState(inst.State)))
+	}
+	return false
+}
@@ -8,21 +8,31 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroups"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	qc "github.com/bevelwork/quick_color"
 	versionpkg "github.com/bevelwork/quick_ssm/version"
@@ -32,10 +42,89 @@ import (
 
 // InstanceInfo represents an EC2 instance with its metadata for display purposes.
 type InstanceInfo struct {
-	ID          string // The EC2 instance ID
-	Name        string // The instance name from EC2 tags
-	DisplayName string // The formatted display name (may include numbering for duplicates)
-	State       string // The instance state (running, stopped, pending, etc.)
+	ID          string            // The EC2 instance ID
+	Name        string            // The instance name from EC2 tags
+	DisplayName string            // The formatted display name (may include numbering for duplicates)
+	State       string            // The instance state (running, stopped, pending, etc.)
+	Type        string            // The instance type, e.g. t3.micro
+	AZ          string            // The availability zone
+	Lifecycle   string            // The instance lifecycle ("spot", "scheduled", or empty for on-demand)
+	Arch        string            // The CPU architecture (x86_64, arm64, etc.)
+	ImageID     string            // The AMI the instance was launched from
+	KeyName     string            // The SSH key pair the instance was launched with, empty if none or unknown
+	PingStatus  string            // The SSM agent ping status (Online, ConnectionLost, Inactive), empty if unknown
+	LastPing    time.Time         // The last time the SSM agent checked in
+	PrivateIPs  []string          // All private IPs across the instance's network interfaces, primary first
+	PrivateDNS  string            // The private DNS name, e.g. ip-10-0-1-5.ec2.internal; empty if unassigned
+	PublicDNS   string            // The public DNS name; empty without a public IP or VPC DNS hostnames
+	OwnerID     string            // The account that owns the instance's reservation
+	Platform    string            // "windows" for Windows instances, empty otherwise
+	LaunchTime  time.Time         // When the instance was last launched; zero with --fast
+	Denied      string            // Why connecting is refused when the instance is on the deny list, empty otherwise
+	CPU         *float64          // Recent average CPUUtilization percent with --show-metrics, nil if unknown
+	Health      string            // EC2 status check summary (ok, impaired, initializing), empty if not running or unknown
+	Tags        map[string]string // All EC2 tags on the instance
+}
+
+// InstanceFilter holds the criteria used to narrow down the instances returned
+// by getInstances.
+type InstanceFilter struct {
+	Name            string         // Case-insensitive substring match against the instance name
+	Lifecycle       string         // "spot", "ondemand", or "all"
+	Stack           string         // CloudFormation stack name (aws:cloudformation:stack-name tag)
+	Arch            string         // CPU architecture, e.g. arm64 or x86_64
+	AMIs            []string       // Only instances launched from one of these AMI IDs
+	LaunchTemplate  string         // Only instances launched from this launch template ID
+	TemplateVersion string         // With LaunchTemplate, only instances launched from this version
+	LabelTag        string         // Tag whose value is used as the instance name instead of Name
+	ExcludeTags     []TagMatch     // Instances matching any of these tags are removed
+	Owner           string         // Only keep instances whose reservation is owned by this account (empty = any)
+	HideTerminating bool           // Remove instances that are shutting down or stopping
+	States          []string       // Only instances in one of these states (empty = any)
+	InstanceIDs     []string       // Only these instances (empty = any); queried in chunks of filterValueLimit
+	APIFilters      []types.Filter // Additional server-side DescribeInstances filters
+}
+
+// TagMatch is a KEY=VALUE pair used to match instance tags.
+type TagMatch struct {
+	Key   string
+	Value string
+}
+
+// stringListFlag collects repeated or comma-separated flag values.
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+// tagListFlag collects repeated KEY=VALUE flag values.
+type tagListFlag []TagMatch
+
+func (t *tagListFlag) String() string {
+	parts := make([]string, len(*t))
+	for i, m := range *t {
+		parts[i] = m.Key + "=" + m.Value
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *tagListFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("invalid tag %q (expected KEY=VALUE)", value)
+	}
+	*t = append(*t, TagMatch{Key: strings.TrimSpace(key), Value: strings.TrimSpace(val)})
+	return nil
 }
 
 // Deprecated: kept for backward compatibility if older ldflags are used.
@@ -45,15 +134,104 @@ var version = ""
 func main() {
 	// Parse flags
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s [flags] [-- aws-cli-args...]:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	versionFlag := flag.Bool("version", false, "Print version and exit")
 	portForward := flag.String("port-forward", "", "Port forward in the form LOCAL:REMOTE or a single port (uses same local and remote)")
+	autoPort := flag.Bool("auto-port", false, "With --port-forward, use the next free local port when the requested one is in use")
+	chooseMethod := flag.Bool("choose-method", false, "After selecting an instance, ask whether to open a shell, a port forward, or RDP (Windows) instead of needing the flag up front")
+	pingSessionFlag := flag.Bool("ping-session", false, "Instead of connecting, run a short non-interactive session to test that connecting works; exits 1 on failure")
+	pingTimeout := flag.Duration("ping-timeout", 30*time.Second, "With --ping-session, how long to wait for the test session")
+	waitOnline := flag.Duration("wait-online", 0, "Before connecting, wait up to this long (e.g. 5m) for the instance to report Online in SSM")
+	initCommand := flag.String("init-command", "", "Command to run when the session opens, e.g. 'cd /srv/app && exec bash' (uses AWS-StartInteractiveCommand)")
+	documentName := flag.String("document-name", "", "Session document to start, or ssm:/PARAMETER to read the document name from Parameter Store")
+	rdp := flag.Bool("rdp", false, fmt.Sprintf("Forward local port %d to RDP (%d) on a Windows instance", rdpLocalPort, rdpRemotePort))
+	rdpLaunch := flag.Bool("rdp-launch", false, "With --rdp, open the system RDP client once the tunnel is ready")
+	maxDuration := flag.String("max-duration", "", "Maximum session length, e.g. 30m or 2h (1m to 24h); the session is ended when it elapses")
+	targetIP := flag.String("target-ip", "", "Private IP to forward to when port forwarding (defaults to the instance's primary IP)")
 	checkMode := flag.Bool("check", false, "Perform diagnostic checks on the selected instance")
+	checkAll := flag.Bool("check-all", false, "Perform diagnostic checks on every listed instance")
+	groupBy := flag.String("group-by", groupByVPC, "With --check-all, group results by vpc, subnet, or none")
+	lint := flag.Bool("lint", false, "Report fleet hygiene issues, such as instances without a Name tag, and exit")
+	csvOut := flag.Bool("csv", false, "Write the instance list as CSV to stdout and exit")
+	jsonOut := flag.Bool("json", false, "Write the instance list (or --check/--check-all results) as JSON to stdout and exit")
+	porcelain := flag.Bool("porcelain", false, "Write a stable, tab-separated listing (index, id, name, state) to stdout and exit")
+	quiet := flag.Bool("quiet", false, "Suppress progress output")
+	forceInteractive := flag.Bool("interactive", false, "Force prompts, colors, and progress output even in CI or without a TTY")
+	noColor := flag.Bool("no-color", false, "Disable colored output")
+	printMenu := flag.Bool("print-menu", false, "Print the numbered instance menu and exit without prompting")
+	printID := flag.Bool("print-id", false, "Print the selected instance ID and exit instead of connecting")
+	copyID := flag.Bool("copy-id", false, "Copy the selected instance ID to the clipboard and exit instead of connecting")
+	printImport := flag.Bool("print-import", false, "Print terraform import and aws CLI commands for the selected instance and exit instead of connecting")
+	recordCast := flag.String("record", "", "Record the interactive session with its timing as an asciinema .cast file at PATH (or in PATH when it is a directory)")
+	instructions := flag.Bool("instructions", false, "Print commented commands for connecting (or tunneling, with --port-forward) to the selected instance and exit instead of connecting, e.g. for runbooks")
+	runCmd := flag.String("run", "", "Run a shell command on the selected instances via SSM Run Command instead of connecting")
+	follow := flag.Bool("follow", false, "With --run, print command output as it arrives instead of when the command finishes")
+	outputS3Bucket := flag.String("output-s3-bucket", "", "With --run, also write the full command output to this S3 bucket (output over 24000 characters is otherwise truncated)")
+	runPreset := flag.String("run-preset", "", "Run a named command preset from the config file (see --list-presets) instead of connecting")
+	listPresets := flag.Bool("list-presets", false, "List the command presets defined in the config file and exit")
+	assumeYes := flag.Bool("yes", false, "Skip the --run/--run-preset confirmation (the preview is still printed)")
+	loop := flag.Bool("loop", false, "Return to the instance menu after each session instead of exiting")
+	refreshStatus := flag.Bool("refresh-status", false, "With --loop, reload SSM status before showing the menu again")
+	describeMode := flag.Bool("describe", false, "Print details about the selected instance instead of connecting")
+	mySessions := flag.Bool("sessions", false, "List your active SSM sessions and optionally resume or terminate one")
+	diagnoseLast := flag.Bool("diagnose-last", false, "Run diagnostics against the instance from the last failed connection and exit")
+	noAutoDiagnose := flag.Bool("no-auto-diagnose", false, "Do not run diagnostics automatically when a connection fails")
+	var onlyChecks stringListFlag
+	flag.Var(&onlyChecks, "only", "With --check, run only these checks: state, iam, internet, ssm, nacl, dns, agent, or metadata (repeatable or comma-separated)")
+	fixScript := flag.String("fix-script", "", "With --check, write a shell script of aws commands that remediate failed checks to FILE")
+	preferAZ := flag.String("az", "", "When --target names several instances (e.g. an Auto Scaling group), prefer one in this availability zone")
+	target := flag.String("target", "", "Connect directly to an instance ID, EC2 instance ARN, exact name, private/public DNS name, or tag expression (KEY=VALUE,...) without the menu")
+	strictTargetFlag := flag.Bool("strict-target", false, "Fail when --target matches several instances instead of prompting to pick one (always on without a TTY)")
 	filterStr := flag.String("filter", "", "Filter instances by name (including substrings)")
+	stateFlag := flag.String("state", "running", "Only list instances in these states, comma-separated (e.g. running,stopped), or all")
+	lifecycle := flag.String("lifecycle", "all", "Filter instances by lifecycle: spot, ondemand, or all")
+	sortMode := flag.String("sort", sortByName, "Menu order: name, online (SSM online and running first), last-active (most recent SSM ping first), state, or launch (newest first); can also be changed at the menu prompt with e.g. \"sort state\"")
+	labelTag := flag.String("label-tag", "", "Tag to display as the instance name (falls back to the Name tag)")
+	requireMetadataTags := flag.Bool("require-metadata-tags", false, "With --check, warn when instance metadata tags are disabled")
+	var prodAccounts stringListFlag
+	flag.Var(&prodAccounts, "prod-account", "Treat these account IDs as production and show a red header (repeatable or comma-separated)")
+	summaryOnly := flag.Bool("summary-only", false, "With --check or --check-all, print only the pass/warn/fail counts and verdict instead of every check or instance")
+	arch := flag.String("arch", "", "Only list instances with this architecture: arm64 or x86_64")
+	showMetrics := flag.Bool("show-metrics", false, "Show each running instance's recent average CPU from CloudWatch in the menu (extra API calls)")
+	annotateIssues := flag.Bool("annotate-issues", false, "Note in the menu why running instances are not connectable (agent offline, not registered)")
+	columnsStr := flag.String("columns", "1", "Lay the menu out in this many columns, or auto to fill the terminal width")
+	showArch := flag.Bool("show-arch", false, "Show each instance's CPU architecture in the menu")
+	showKey := flag.Bool("show-key", false, "Show each instance's SSH key pair name in the menu (- when it has none)")
+	stack := flag.String("stack", "", "Only list instances belonging to this CloudFormation stack")
+	var amis stringListFlag
+	flag.Var(&amis, "ami", "Only list instances launched from these AMI IDs (comma-separated or repeatable)")
+	launchTemplate := flag.String("launch-template", "", "Only list instances launched from this launch template ID or name, optionally as ID:VERSION")
+	hideTerminating := flag.Bool("hide-terminating", false, "Hide instances that are shutting down or stopping")
+	healthyOnly := flag.Bool("healthy-only", false, "Hide instances whose EC2 system or instance status checks are not ok")
+	selectIndex := flag.Int("select", 0, "Pick the Nth instance of the (filtered, sorted) menu without prompting, as if N were typed at the prompt")
+	latest := flag.Bool("latest", false, "Connect to the most recently launched matching instance without the menu")
+	fast := flag.Bool("fast", false, "List instances with the lighter DescribeInstanceStatus API (names and states only; not combinable with --arch or --lifecycle)")
+	ownerSelf := flag.Bool("owner-self", true, "Hide instances owned by other accounts, e.g. in shared VPCs (use --owner-self=false to show them)")
+	owner := flag.String("owner", "", "Only list instances owned by this account ID (overrides --owner-self)")
+	resourceGroup := flag.String("resource-group", "", "Only list instances that belong to this AWS Resource Group")
+	listStacks := flag.Bool("list-stacks", false, "List the CloudFormation stacks that own instances and exit")
+	var excludeTags tagListFlag
+	flag.Var(&excludeTags, "exclude-tag", "Hide instances with tag KEY=VALUE (repeatable)")
+	pluginPath := flag.String("plugin-path", "", "Path to session-manager-plugin or its directory (defaults to $SSM_PLUGIN_PATH, then PATH)")
+	endpointURL := flag.String("endpoint-url", "", "Override the AWS endpoint URL, e.g. http://localhost:4566 for LocalStack")
+	caBundle := flag.String("ca-bundle", "", "PEM CA bundle for TLS to AWS, e.g. behind a corporate proxy (defaults to $AWS_CA_BUNDLE)")
+	searchAllRegions := flag.Bool("search-all-regions", false, "When --target matches nothing in the current region, search every enabled region and offer to connect where it is found")
+	configPath := flag.String("config", "", "Load configuration from this file instead of quick_ssm/config.json in the user config directory")
 	region := flag.String("region", "", "AWS region to use (defaults to current region)")
+	pickRegion := flag.Bool("pick-region", false, "Choose the region from a menu of enabled regions (ignored when --region is set)")
+	verbose := flag.Bool("verbose", false, "Show additional details such as the credential source")
+	whoami := flag.Bool("whoami", false, "Print the caller identity and credential source, then exit")
+	waitForInstances := flag.Duration("wait-for-instances", 0, "When no instances match, keep polling for up to this long (e.g. 5m) for them to appear, such as after launching a stack")
+	var denyIDs stringListFlag
+	flag.Var(&denyIDs, "deny-id", "Refuse to connect to these instance IDs, in addition to the config deny list (repeatable or comma-separated)")
+	precheckPerms := flag.Bool("precheck-perms", false, "Before listing, check with iam:SimulatePrincipalPolicy that you may start sessions")
+	eventSink := flag.String("event-sink", "", "Also emit a JSON event for each connection to this file (appended) or http(s) URL (POSTed)")
+	ticket := flag.String("ticket", "", "Ticket ID (e.g. OPS-1234) to record in the session history and as the session reason")
 	privateMode := flag.Bool("private-mode", false, "Hide account information during execution")
+	rememberHereFlag := flag.Bool("remember-here", false, "Save this command's region and filter flags for the current directory and apply them on later runs here")
+	forgetHereFlag := flag.Bool("forget-here", false, "Clear the filters saved for the current directory with --remember-here and exit")
 	flag.Parse()
 
 	if *versionFlag {
@@ -61,229 +239,1512 @@ func main() {
 		return
 	}
 
+	if *forgetHereFlag {
+		removed, err := forgetHere()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if removed {
+			fmt.Println("Forgot the filters saved for this directory")
+		} else {
+			fmt.Println("No filters are saved for this directory")
+		}
+		return
+	}
+	if *rememberHereFlag {
+		scope, err := rememberHere(flag.CommandLine)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Remembered %d filter flag(s) for %s\n", len(scope.Flags), scope.Dir)
+	} else {
+		applied, err := applyRememberedScope(flag.CommandLine)
+		if err != nil {
+			log.Println("[WARNING]: could not apply saved filters:", err)
+		} else if len(applied) > 0 {
+			fmt.Fprintln(os.Stderr, color("Using filters saved for this directory: "+strings.Join(applied, " "), qc.ColorCyan))
+		}
+	}
+
+	// Decorative and blocking behavior is gated on running interactively so
+	// pipelines get clean logs and never hang waiting for input.
+	outputFormats := 0
+	for _, set := range []bool{*csvOut, *jsonOut, *porcelain} {
+		if set {
+			outputFormats++
+		}
+	}
+	if outputFormats > 1 {
+		log.Fatal("--csv, --json, and --porcelain cannot be used together")
+	}
+	machineOutput := outputFormats > 0
+	if *selectIndex != 0 {
+		switch {
+		case *selectIndex < 0:
+			log.Fatal("--select must be a positive menu number")
+		case *target != "" || *latest:
+			log.Fatal("--select cannot be combined with --target or --latest")
+		}
+	}
+	if *searchAllRegions {
+		switch {
+		case *target == "":
+			log.Fatal("--search-all-regions requires --target")
+		case *endpointURL != "":
+			log.Fatal("--search-all-regions cannot be combined with --endpoint-url")
+		case *launchTemplate != "" || *resourceGroup != "":
+			// Both resolve to IDs that only exist in the current region.
+			log.Fatal("--search-all-regions cannot be combined with --launch-template or --resource-group")
+		}
+	}
+	if !isValidGroupBy(*groupBy) {
+		log.Fatal("--group-by must be vpc, subnet, or none")
+	}
+	if *jsonOut && *checkMode && *target == "" {
+		log.Fatal("--json with --check requires --target")
+	}
+
+	interactive = *forceInteractive || detectInteractive()
+	if (*runCmd != "" || *runPreset != "") && !*assumeYes && !interactive {
+		log.Fatal("--run in non-interactive mode requires --yes")
+	}
+	// Machine-readable output goes to stdout, where a prompt would corrupt it.
+	strictTarget = *strictTargetFlag || machineOutput
+	colorEnabled = interactive && !*noColor && !noColorRequested() && !machineOutput
+	if !interactive || machineOutput {
+		*quiet = true
+	}
+
 	// Confirm that the AWS CLI is installed
 	if _, err := exec.LookPath("aws"); err != nil {
 		log.Fatal("AWS CLI not found. Please install it and try again. https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html#getting-started-install-instructions")
 	}
+	// AWS CLI v1 handles start-session and the session-manager-plugin
+	// differently enough to cause confusing failures, so warn early.
+	cliVersion, err := detectAWSCLIVersion()
+	if err != nil {
+		log.Println("[WARNING]:", err)
+	} else if cliVersion.Major < 2 && !machineOutput {
+		fmt.Println(color(fmt.Sprintf(
+			"⚠️  WARNING: AWS CLI %s detected. quick_ssm requires AWS CLI v2 for SSM sessions. Upgrade: %s",
+			cliVersion, awsCLIUpgradeURL,
+		), qc.ColorYellow))
+	}
+	// The AWS CLI shells out to the session manager plugin, which may live
+	// outside the PATH in custom installs.
+	if *pluginPath == "" {
+		*pluginPath = os.Getenv("SSM_PLUGIN_PATH")
+	}
+	pluginDir := ""
+	if *pluginPath != "" {
+		if pluginDir, err = resolvePluginDir(*pluginPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !findSessionManagerPlugin(pluginDir) && !machineOutput {
+		fmt.Println(color(fmt.Sprintf(
+			"⚠️  WARNING: %s not found. SSM sessions will fail until it is installed: %s",
+			sessionManagerPluginBinary, sessionManagerPluginInstallURL,
+		), qc.ColorYellow))
+	}
+	// An instance ARN says which region the instance lives in, so connect
+	// there even when the default region differs.
+	if arnRegion := regionFromTarget(*target); arnRegion != "" && arnRegion != *region {
+		if *region != "" {
+			log.Printf("[WARNING]: --region %s conflicts with the target ARN's region; using %s", *region, arnRegion)
+		} else if !machineOutput {
+			fmt.Printf("Using region %s from the target ARN\n", colorBold(arnRegion, qc.ColorGreen))
+		}
+		*region = arnRegion
+	}
 	// Confirm this looks like a region
 	if *region != "" && strings.Count(*region, "-") != 2 {
 		log.Fatal("Region must be specified as a region name, e.g. us-east-1")
 	}
 
-	ctx := context.Background()
-
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(*region))
+	if !isValidLifecycle(*lifecycle) {
+		log.Fatal("Lifecycle must be one of: spot, ondemand, all")
+	}
+	if !isValidSortMode(*sortMode) {
+		log.Fatal("Sort must be one of: " + strings.Join(sortModes, ", "))
+	}
+	if *arch != "" && !isValidArch(*arch) {
+		log.Fatal("Architecture must be one of: " + strings.Join(validArchitectures(), ", "))
+	}
+	instanceStates, err := parseInstanceStates(*stateFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
-	stsClient := sts.NewFromConfig(cfg)
-	callerIdentity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
-	if err != nil {
-		log.Fatal(fmt.Errorf("failed to authenticate with aws: %v", err))
+	// The running-only default is for browsing the menu. An explicit
+	// --target is found in any state, so a stopped instance can still be
+	// diagnosed, unless --state was given (or remembered) too.
+	stateSet := false
+	flag.Visit(func(f *flag.Flag) { stateSet = stateSet || f.Name == "state" })
+	if *target != "" && !stateSet {
+		instanceStates = nil
 	}
-	printHeader(*checkMode, *privateMode, callerIdentity)
 
-	ec2Client := ec2.NewFromConfig(cfg)
-	instances, err := getInstances(ctx, ec2Client, filterStr)
+	for _, key := range onlyChecks {
+		if !isValidCheckKey(key) {
+			log.Fatal("--only must be one of: " + strings.Join(checkNames(), ", "))
+		}
+		if key == checkKeyMetadata {
+			*requireMetadataTags = true
+		}
+	}
+	userConfig, err := loadConfig(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if len(instances) == 0 {
-		log.Fatal("No instances found")
+	if *listPresets {
+		printPresets(userConfig)
+		return
+	}
+	if userConfig.DuplicateNames != "" {
+		if err := validateDuplicateNameStyle(userConfig.DuplicateNames); err != nil {
+			log.Fatal(err)
+		}
+		duplicateNameStyle = userConfig.DuplicateNames
+	}
+	if targetPriority, err = parseTargetPriority(userConfig.TargetPriority); err != nil {
+		log.Fatal(err)
 	}
-	longestName := 0
-	for _, inst := range instances {
-		if len(inst.DisplayName) > longestName {
-			longestName = len(inst.DisplayName)
+	if len(prodAccounts) > 0 {
+		if userConfig.Environments == nil {
+			userConfig.Environments = map[string][]string{}
+		}
+		userConfig.Environments[envProd] = append(userConfig.Environments[envProd], prodAccounts...)
+	}
+	if *latest && (*target != "" || *fast) {
+		log.Fatal("--latest cannot be combined with --target or --fast")
+	}
+	if *fast && *runPreset != "" {
+		// Fast listing leaves Platform empty, so Windows instances would be
+		// sent the shell variant of the preset.
+		log.Fatal("--run-preset cannot be combined with --fast")
+	}
+	if *runCmd != "" && *runPreset != "" {
+		log.Fatal("--run and --run-preset cannot be used together")
+	}
+	if (*follow || *outputS3Bucket != "") && *runCmd == "" && *runPreset == "" {
+		log.Fatal("--follow and --output-s3-bucket require --run or --run-preset")
+	}
+	// A --run command is sent as-is to both Linux and Windows instances.
+	commandSpec := CommandSpec{Shell: *runCmd, PowerShell: *runCmd}
+	if *runPreset != "" {
+		if commandSpec, err = userConfig.preset(*runPreset); err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	for i, inst := range instances {
-		// Alternate row colors for better readability
-		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+	diagOpts := DiagnosticOptions{
+		RequireMetadataTags: *requireMetadataTags,
+		Only:                onlyChecks,
+		SummaryOnly:         *summaryOnly,
+	}
 
-		// Color code the state
-		stateColor := colorInstState(inst.State)
-		entry := fmt.Sprintf(
-			"%3d. %-*s %s [%s]",
-			i+1, longestName, inst.DisplayName, inst.ID,
-			qc.Color(inst.State, stateColor),
-		)
-		fmt.Println(qc.Color(entry, rowColor))
+	// Anything after "--" is handed to aws ssm start-session untouched, as
+	// long as it does not override the flags quick_ssm manages itself.
+	if err := validatePassthroughArgs(flag.Args(), managedSessionFlags...); err != nil {
+		log.Fatal(err)
+	}
+	if *rdp {
+		if strings.TrimSpace(*portForward) != "" {
+			log.Fatal("--rdp cannot be combined with --port-forward")
+		}
+		*portForward = fmt.Sprintf("%d:%d", rdpLocalPort, rdpRemotePort)
+	} else if *rdpLaunch {
+		log.Fatal("--rdp-launch requires --rdp")
+	}
+	if *recordCast != "" {
+		if strings.TrimSpace(*portForward) != "" {
+			log.Fatal("--record only records interactive sessions and cannot be combined with --port-forward or --rdp")
+		}
+		if *loop {
+			log.Fatal("--record cannot be combined with --loop")
+		}
+		if runtime.GOOS == "windows" {
+			log.Fatal("--record is not supported on Windows")
+		}
+	}
+	if *eventSink != "" {
+		connectionEvents = newEventSink(*eventSink)
+		defer connectionEvents.wait(eventSinkTimeout)
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("%s", qc.Color("Select instance. Blank, or non-numeric input will exit: ", qc.ColorYellow))
-	input, err := reader.ReadString('\n')
+	sessionOpts := SessionOptions{Env: pluginPathEnv(pluginDir), ExtraArgs: flag.Args()}
+	if *ticket != "" {
+		if err := validateTicket(*ticket); err != nil {
+			log.Fatal(err)
+		}
+		// Older CLIs reject --reason, so the ticket is then only kept locally.
+		if cliVersion.supportsSessionReason() {
+			sessionOpts.Reason = "ticket " + *ticket
+		}
+	}
+	if *maxDuration != "" {
+		sessionOpts.MaxDuration, err = parseMaxDuration(*maxDuration)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *endpointURL != "" {
+		sessionOpts.EndpointURL = *endpointURL
+	}
+	// The aws CLI subprocess reads the bundle from the environment.
+	if *caBundle != "" {
+		sessionOpts.Env = append(sessionOpts.Env, caBundleEnv+"="+*caBundle)
+	}
+
+	ctx := context.Background()
+
+	loadOpts, err := awsConfigOptions(*region, *endpointURL, *caBundle)
 	if err != nil {
 		log.Fatal(err)
 	}
-	input = input[:len(input)-1]
-	if input == "" {
-		fmt.Println("Exiting")
-		return
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		log.Fatal(err)
 	}
-	inputInt, err := strconv.Atoi(input)
+	// Only an explicit region is checked; a configured default is assumed to
+	// work, and a custom endpoint may not implement DescribeRegions.
+	if *region != "" && *endpointURL == "" {
+		if err := checkRegionEnabled(ctx, cfg, *region); err != nil {
+			log.Fatal(err)
+		}
+	}
+	reader := bufio.NewReader(os.Stdin)
+	promptRegion := *pickRegion && *region == ""
+	currentRegion := cfg.Region
+	if promptRegion && cfg.Region == "" {
+		cfg.Region = defaultBootstrapRegion
+	}
+	stsClient := sts.NewFromConfig(cfg)
+	callerIdentity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
-		fmt.Println("Non-numeric input. Exiting")
+		log.Fatal(fmt.Errorf("failed to authenticate with aws: %v", err))
+	}
+	credentialSource := ""
+	if *verbose || *whoami {
+		credentialSource = describeCredentialSource(ctx, cfg, *privateMode)
+	}
+	env := userConfig.environmentFor(derefOr(callerIdentity.Account, ""), cfg.Region)
+	envColor, err := userConfig.environmentColor(env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !machineOutput && !*printMenu {
+		printHeader(*checkMode || *checkAll || *diagnoseLast, *privateMode, callerIdentity, credentialSource, env, envColor)
+	}
+	if *whoami {
 		return
 	}
-	selectedInstance := instances[inputInt-1]
-	fmt.Printf(
-		"Selected instance: %s %s [%s]\n",
-		qc.ColorizeBold(selectedInstance.DisplayName, qc.ColorGreen),
-		qc.Color(selectedInstance.ID, qc.ColorWhite),
-		qc.Color(selectedInstance.State, colorInstState(selectedInstance.State)),
-	)
 
-	// Warn if instance is not running
-	if selectedInstance.State != "running" {
-		var warningColor string
-		var warningMessage string
-
-		switch selectedInstance.State {
-		case "stopped", "stopping":
-			warningColor = qc.ColorRed
-			warningMessage = "⚠️  WARNING: Instance is not running - SSM connection will likely fail!"
-		case "terminated", "shutting-down":
-			warningColor = qc.ColorRed
-			if selectedInstance.State == "terminated" {
-				warningMessage = "⚠️  WARNING: Instance is terminated - SSM connection is impossible!"
-			} else {
-				warningMessage = "⚠️  WARNING: Instance is shutting down - SSM connection is impossible!"
-			}
-		case "pending", "starting":
-			warningColor = qc.ColorYellow
-			warningMessage = "⚠️  WARNING: Instance is still starting - SSM connection may not be ready yet"
-		default:
-			warningColor = qc.ColorYellow
-			warningMessage = fmt.Sprintf("⚠️  WARNING: Instance is in %s state - SSM connection may not be available", selectedInstance.State)
+	if promptRegion {
+		regions, err := getEnabledRegions(ctx, ec2.NewFromConfig(cfg), derefOr(callerIdentity.Account, "unknown"))
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to list enabled regions: %v", err))
 		}
+		cfg.Region, err = promptForRegion(reader, regions, currentRegion)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Using region %s\n", colorBold(cfg.Region, qc.ColorGreen))
+	}
 
-		fmt.Printf("%s\n", qc.Color(warningMessage, warningColor))
-		fmt.Printf("%s", qc.Color("Continue anyway? (y/N): ", qc.ColorYellow))
+	if *precheckPerms {
+		reportSessionPermissions(ctx, iam.NewFromConfig(cfg), derefOr(callerIdentity.Arn, ""), cfg.Region, derefOr(callerIdentity.Account, ""))
+	}
 
-		confirmInput, err := reader.ReadString('\n')
+	if *diagnoseLast {
+		last, err := loadFailedConnection()
 		if err != nil {
 			log.Fatal(err)
 		}
-		confirmInput = strings.TrimSpace(confirmInput)
+		// Diagnose in the region the connection was attempted in unless
+		// one was given explicitly.
+		if *region == "" && last.Region != "" {
+			cfg.Region = last.Region
+		}
+		fmt.Printf("Diagnosing last failed connection: %s (%s, %s)\n",
+			colorBold(last.InstanceID, qc.ColorWhite), cfg.Region, last.Time.Local().Format(time.RFC822))
+		if _, err := performDiagnostics(ctx, ec2.NewFromConfig(cfg), iam.NewFromConfig(cfg), ssm.NewFromConfig(cfg), last.InstanceID, diagOpts); err != nil {
+			log.Fatal("Diagnostic check failed:", err)
+		}
+		return
+	}
 
-		if confirmInput != "y" && confirmInput != "Y" && confirmInput != "yes" {
-			fmt.Println("Cancelled")
-			return
+	ec2Client := ec2.NewFromConfig(cfg)
+	ssmClient := ssm.NewFromConfig(cfg)
+	sessionOpts.Region = cfg.Region
+	if *documentName != "" {
+		if strings.TrimSpace(*portForward) != "" {
+			log.Fatal("--document-name cannot be combined with --port-forward")
+		}
+		if sessionOpts.Document, err = resolveDocumentName(ctx, ssmClient, *documentName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *initCommand != "" {
+		switch {
+		case strings.TrimSpace(*portForward) != "":
+			log.Println("[WARNING]: --init-command is ignored for port forwarding sessions")
+		case sessionOpts.Document != "" && sessionOpts.Document != interactiveCommandDocument:
+			log.Printf("[WARNING]: --init-command is ignored because document %s does not take a command", sessionOpts.Document)
+		default:
+			sessionOpts.Document = interactiveCommandDocument
+			if sessionOpts.Parameters, err = interactiveCommandParameters(*initCommand); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if *mySessions {
+		sessions, err := getOwnedSessions(ctx, ssmClient, derefOr(callerIdentity.Arn, ""))
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to list sessions: %v", wrapAccessDenied(err, "ssm:DescribeSessions")))
+		}
+		names := sessionTargetNames(ctx, ec2Client, sessions, *labelTag)
+		if err := manageOwnedSessions(ctx, ssmClient, reader, sessions, names, cfg.Region, pluginDir, sessionOpts); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	instanceFilter := InstanceFilter{
+		Name:            *filterStr,
+		Lifecycle:       *lifecycle,
+		Stack:           *stack,
+		Arch:            *arch,
+		AMIs:            amis,
+		LabelTag:        *labelTag,
+		ExcludeTags:     excludeTags,
+		HideTerminating: *hideTerminating,
+		States:          instanceStates,
+	}
+	switch {
+	case *owner != "":
+		instanceFilter.Owner = *owner
+	case *ownerSelf && *fast && *target == "":
+		// Fast listing cannot tell who owns an instance, so the default
+		// owner filter is dropped rather than failing every --fast run.
+		log.Println("[WARNING]: --fast cannot hide instances owned by other accounts; shared-VPC instances may be listed")
+	case *ownerSelf:
+		instanceFilter.Owner = derefOr(callerIdentity.Account, "")
+	}
+	if *launchTemplate != "" {
+		instanceFilter.LaunchTemplate, instanceFilter.TemplateVersion, err = resolveLaunchTemplate(ctx, ec2Client, *launchTemplate)
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
+	if *resourceGroup != "" {
+		groupIDs, err := resourceGroupInstanceIDs(ctx, resourcegroups.NewFromConfig(cfg), *resourceGroup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		instanceFilter.InstanceIDs = groupIDs
+	}
+	// With --search-all-regions, a --target that matches nothing here is
+	// looked for in the other enabled regions. It reports whether the user
+	// switched to the region it was found in.
+	searchOtherRegions := func(instances []*InstanceInfo) bool {
+		if !*searchAllRegions || len(targetMatches(*target, instances)) > 0 {
+			return false
+		}
+		matches, err := searchTargetRegions(ctx, cfg, derefOr(callerIdentity.Account, "unknown"), instanceFilter, *target)
+		if err != nil {
+			log.Println("[WARNING]:", err)
+			return false
+		}
+		reportRegionMatches(*target, matches)
+		if len(matches) == 0 || !interactive || machineOutput {
+			return false
+		}
+		found, err := promptForMatchRegion(reader, matches)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if found == "" {
+			return false
+		}
+		cfg.Region = found
+		ec2Client = ec2.NewFromConfig(cfg)
+		ssmClient = ssm.NewFromConfig(cfg)
+		sessionOpts.Region = cfg.Region
+		fmt.Printf("Using region %s\n", colorBold(cfg.Region, qc.ColorGreen))
+		return true
+	}
 
-	if *checkMode {
-		// Perform diagnostic checks
-		ec2Client := ec2.NewFromConfig(cfg)
+	// Diagnosing a specific target needs neither the full instance list nor
+	// the menu, so it can run unattended, e.g. in CI. The exit code is 1 when
+	// any check fails.
+	if *checkMode && *target != "" {
+		candidates, err := getTargetCandidates(ctx, ec2Client, instanceFilter, *target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if searchOtherRegions(candidates) {
+			if candidates, err = getTargetCandidates(ctx, ec2Client, instanceFilter, *target); err != nil {
+				log.Fatal(err)
+			}
+		}
+		inst, _, err := resolveTargetOrPick(reader, *target, candidates, *preferAZ, MenuOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if inst == nil {
+			return
+		}
 		iamClient := iam.NewFromConfig(cfg)
-		if err := performDiagnostics(ctx, ec2Client, iamClient, selectedInstance.ID); err != nil {
+		var results []DiagnosticResult
+		if *jsonOut {
+			if results, err = runDiagnostics(ctx, ec2Client, iamClient, ssmClient, inst.ID, diagOpts); err == nil {
+				err = writeDiagnosticsJSON(os.Stdout, inst, results)
+			}
+		} else {
+			fmt.Printf("Selected instance: %s %s\n", colorBold(inst.DisplayName, qc.ColorGreen), color(inst.ID, qc.ColorWhite))
+			results, err = performDiagnostics(ctx, ec2Client, iamClient, ssmClient, inst.ID, diagOpts)
+			if err == nil {
+				reportConnectPermission(ctx, iamClient, derefOr(callerIdentity.Arn, ""), cfg.Region, derefOr(callerIdentity.Account, ""), inst.ID, results)
+			}
+		}
+		if err != nil {
 			log.Fatal("Diagnostic check failed:", err)
 		}
+		if *fixScript != "" {
+			reportFixScript(*fixScript, inst.ID, cfg.Region, results)
+		}
+		if _, _, failCount := countResults(results); failCount > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fetchInstances := func() ([]*InstanceInfo, error) {
+		var instances []*InstanceInfo
+		var err error
+		if *target != "" {
+			instances, err = getTargetCandidates(ctx, ec2Client, instanceFilter, *target)
+		} else if *fast {
+			instances, err = getInstancesFast(ctx, ec2Client, instanceFilter)
+		} else {
+			instances, err = getInstances(ctx, ec2Client, instanceFilter)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Fast listing already carries status checks from DescribeInstanceStatus.
+		if !*fast && (!machineOutput || *healthyOnly) {
+			if err := loadInstanceHealth(ctx, ec2Client, instances); err != nil {
+				if *healthyOnly {
+					return nil, fmt.Errorf("failed to load instance status checks: %v", err)
+				}
+				log.Println("[WARNING]: could not load instance status checks:", err)
+			}
+		}
+		if *healthyOnly {
+			instances = filterHealthy(instances)
+		}
+		return instances, nil
+	}
+	instances, err := fetchInstances()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(instances) == 0 && *waitForInstances > 0 {
+		instances, err = pollForInstances(fetchInstances, *waitForInstances, !*quiet && isTerminal(os.Stdout))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *target != "" && searchOtherRegions(instances) {
+		if instances, err = fetchInstances(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Denied instances stay resolvable by --target so the refusal can name
+	// the configured reason.
+	denied := userConfig.deniedInstances(derefOr(callerIdentity.Account, ""), denyIDs)
+	instances = applyDenyList(instances, denied, userConfig.HideDenied && *target == "")
+	if len(instances) == 0 {
+		log.Fatal("No instances found")
+	}
+	statusLoaded := false
+	if sortNeedsSSMStatus(*sortMode) || *csvOut || *jsonOut || *annotateIssues {
+		if err := loadSSMStatus(ctx, ssmClient, instances); err != nil {
+			log.Println("[WARNING]: could not load SSM status:", err)
+			// Without status every instance would look unregistered.
+			*annotateIssues = false
+		} else {
+			statusLoaded = true
+		}
+	}
+	sortInstances(instances, *sortMode)
+	if *csvOut {
+		if err := writeInstancesCSV(os.Stdout, instances); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *jsonOut && !*checkMode && !*checkAll {
+		if err := writeInstancesJSON(os.Stdout, instances); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *porcelain {
+		if err := writeInstancesPorcelain(os.Stdout, instances); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *listStacks {
+		printStacks(instances)
+		return
+	}
+	if *lint {
+		if !printLintReport(instances) {
+			os.Exit(1)
+		}
+		return
+	}
+	if *checkAll {
+		checks := checkAllInstances(ctx, ec2Client, iam.NewFromConfig(cfg), ssmClient, instances, diagOpts, *quiet)
+		// Like --check --target, the exit code is 1 when any instance
+		// failed, so --check-all can gate CI.
+		var failed int
+		if *jsonOut {
+			if err := writeCheckAllJSON(os.Stdout, checks); err != nil {
+				log.Fatal(err)
+			}
+			failed = countFailedInstances(checks)
+		} else {
+			_, _, failed = displayCheckAllResults(checks, *groupBy, *summaryOnly)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	columns, err := parseColumnsFlag(*columnsStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *showMetrics {
+		if err := loadCPUMetrics(ctx, cloudwatch.NewFromConfig(cfg), instances); err != nil {
+			log.Println("[WARNING]: could not load CloudWatch metrics:", err)
+			*showMetrics = false
+		}
+	}
+	menuOpts := MenuOptions{
+		ShowStack:   *stack != "",
+		ShowArch:    *showArch,
+		ShowKey:     *showKey,
+		ShowAMI:     len(amis) > 0 || *launchTemplate != "",
+		ShowMetrics: *showMetrics,
+		Columns:     columns,
+		Annotate:    *annotateIssues,
+		Highlight:   *filterStr,
+	}
+	if *printMenu {
+		printInstanceMenu(instances, menuOpts)
 		return
 	}
 
-	// If port forwarding is requested, start a port forwarding session
-	if strings.TrimSpace(*portForward) != "" {
-		localPort, remotePort, err := parsePortForwardFlag(*portForward)
+	if *runCmd != "" || *runPreset != "" {
+		var targets []*InstanceInfo
+		if *selectIndex > 0 {
+			inst, err := selectByIndex(instances, *selectIndex)
+			if err != nil {
+				log.Fatal(err)
+			}
+			targets = []*InstanceInfo{inst}
+		} else if *target != "" {
+			inst, _, err := resolveTargetOrPick(reader, *target, instances, *preferAZ, menuOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if inst == nil {
+				return
+			}
+			targets = []*InstanceInfo{inst}
+		} else {
+			if !interactive {
+				log.Fatal(errNonInteractive)
+			}
+			printInstanceMenu(instances, menuOpts)
+			targets, err = promptForInstances(reader, instances)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if targets == nil {
+				return
+			}
+		}
+		for _, inst := range targets {
+			if err := checkNotDenied(inst); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := validateCommandSpec(commandSpec, targets); err != nil {
+			log.Fatal(err)
+		}
+		ok, err := confirmRunCommand(reader, targets, commandSpec, *assumeYes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			fmt.Println("Cancelled")
+			return
+		}
+		results, err := runCommand(ctx, ssmClient, cloudwatchlogs.NewFromConfig(cfg), targets, commandSpec, RunOptions{Follow: *follow, OutputS3Bucket: *outputS3Bucket})
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Printf("Starting port forward %d -> %s:%d. This may take a few moments...\n", localPort, selectedInstance.ID, remotePort)
-		if err := startSSMPortForwardSession(selectedInstance.ID, localPort, remotePort); err != nil {
-			log.Fatal("SSM port-forward session failed:", err)
+		if !displayCommandResults(results, *follow) {
+			os.Exit(1)
 		}
 		return
 	}
 
-	fmt.Println("Connecting to instance. This may take a few moments: ")
+	// With --loop, the menu is shown again after each session so several
+	// instances can be visited in one run. Exiting the menu ends the loop.
+	loopMenu := *loop && *target == "" && !*latest && *selectIndex == 0 && interactive
+	refreshLoopMenu := func() {
+		fmt.Println()
+		if *refreshStatus {
+			if err := loadSSMStatus(ctx, ssmClient, instances); err != nil {
+				log.Println("[WARNING]: could not refresh SSM status:", err)
+			}
+			sortInstances(instances, *sortMode)
+		}
+	}
+	// An instance picked from the menu may have been terminated since the
+	// list was loaded. It is dropped and the list reloaded so the user can
+	// pick again instead of the run failing.
+	canRepick := *target == "" && !*latest && *selectIndex == 0 && interactive
+	dropGoneInstance := func(gone *InstanceInfo) {
+		fmt.Println(color(fmt.Sprintf("%s (%s) no longer exists; refreshing the instance list...", gone.DisplayName, gone.ID), qc.ColorYellow))
+		instances = removeInstance(instances, gone.ID)
+		fresh, err := fetchInstances()
+		if err != nil {
+			log.Println("[WARNING]: could not refresh the instance list:", err)
+		} else {
+			instances = applyDenyList(fresh, denied, userConfig.HideDenied)
+			if statusLoaded {
+				if err := loadSSMStatus(ctx, ssmClient, instances); err != nil {
+					log.Println("[WARNING]: could not refresh SSM status:", err)
+				}
+			}
+			sortInstances(instances, *sortMode)
+		}
+		if len(instances) == 0 {
+			log.Fatal("No instances found")
+		}
+		fmt.Println()
+	}
+	for {
+		diagnoseSelected := *checkMode
+		var selectedInstance *InstanceInfo
+		if *target != "" {
+			var diagnose bool
+			selectedInstance, diagnose, err = resolveTargetOrPick(reader, *target, instances, *preferAZ, menuOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if selectedInstance == nil {
+				return
+			}
+			diagnoseSelected = diagnoseSelected || diagnose
+		} else if *selectIndex > 0 {
+			selectedInstance, err = selectByIndex(instances, *selectIndex)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if *latest {
+			newest := latestLaunched(instances)
+			switch {
+			case len(newest) == 0:
+				log.Fatal("No instance has a launch time")
+			case len(newest) == 1:
+				selectedInstance = newest[0]
+			case !interactive:
+				log.Fatalf("%d instances share the newest launch time; use --target instead", len(newest))
+			default:
+				fmt.Println(color(fmt.Sprintf("%d instances were launched at the same time:", len(newest)), qc.ColorYellow))
+				printInstanceMenu(newest, menuOpts)
+				picked, _, err := promptForInstance(reader, newest, false)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if len(picked) == 0 {
+					return
+				}
+				selectedInstance = picked[0]
+			}
+			fmt.Printf("Latest instance launched %s\n", selectedInstance.LaunchTime.Local().Format(time.RFC822))
+		} else {
+			if !interactive {
+				log.Fatal(errNonInteractive)
+			}
+			printInstanceMenu(instances, menuOpts)
+			forwarding := strings.TrimSpace(*portForward) != ""
+			selected, diagnose, err := promptForInstance(reader, instances, forwarding && !*rdp)
+			var sortRequest *SortRequest
+			if errors.As(err, &sortRequest) {
+				if !isValidSortMode(sortRequest.Mode) {
+					fmt.Println(color("Sort by one of: "+strings.Join(sortModes, ", "), qc.ColorYellow))
+					continue
+				}
+				if sortNeedsSSMStatus(sortRequest.Mode) && !statusLoaded {
+					if err := loadSSMStatus(ctx, ssmClient, instances); err != nil {
+						log.Println("[WARNING]: could not load SSM status:", err)
+					} else {
+						statusLoaded = true
+					}
+				}
+				*sortMode = sortRequest.Mode
+				sortInstances(instances, *sortMode)
+				fmt.Println()
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(selected) == 0 {
+				return
+			}
+			if len(selected) > 1 {
+				for _, inst := range selected {
+					if err := checkNotDenied(inst); err != nil {
+						log.Fatal(err)
+					}
+				}
+				if err := openBatchTunnels(selected, *portForward, *autoPort, sessionOpts, func(inst *InstanceInfo) {
+					recordSession(inst, cfg.Region, callerIdentity, "port-forward", *ticket, *privateMode)
+				}); err != nil {
+					log.Println("Batch port forward failed:", err)
+					if !loopMenu {
+						os.Exit(1)
+					}
+				}
+				if loopMenu {
+					refreshLoopMenu()
+					continue
+				}
+				return
+			}
+			selectedInstance = selected[0]
+			if diagnose {
+				diagnoseSelected = true
+			}
+		}
+		fmt.Printf(
+			"Selected instance: %s %s [%s]\n",
+			colorBold(selectedInstance.DisplayName, qc.ColorGreen),
+			color(selectedInstance.ID, qc.ColorWhite),
+			color(selectedInstance.State, colorInstState(selectedInstance.State)),
+		)
+
+		if *printID || *copyID {
+			if *printID {
+				fmt.Println(selectedInstance.ID)
+			}
+			if *copyID {
+				if err := copyToClipboard(selectedInstance.ID); err != nil {
+					fmt.Println(color(fmt.Sprintf("⚠️  WARNING: could not copy instance ID: %v", err), qc.ColorYellow))
+				} else {
+					fmt.Println(color("Instance ID copied to clipboard", qc.ColorGreen))
+				}
+			}
+			return
+		}
+
+		if *printImport {
+			printImportHelpers(selectedInstance, cfg.Region)
+			return
+		}
+
+		if *instructions {
+			var forward *ForwardInstructions
+			if strings.TrimSpace(*portForward) != "" {
+				localPort, remotePort, err := parsePortForwardFlag(*portForward)
+				if err != nil {
+					log.Fatal(err)
+				}
+				remoteHost, err := selectForwardIP(reader, selectedInstance, *targetIP)
+				if err != nil {
+					log.Fatal(err)
+				}
+				forward = &ForwardInstructions{LocalPort: localPort, RemotePort: remotePort, RemoteHost: remoteHost, RDP: *rdp}
+			}
+			account := derefOr(callerIdentity.Account, "")
+			if *privateMode {
+				account = ""
+			}
+			printConnectInstructions(selectedInstance, cfg.Region, account, sessionOpts, forward)
+			return
+		}
+
+		if *describeMode {
+			if err := describeInstance(ctx, ec2Client, ssmClient, selectedInstance.ID); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		// Warn if instance is not running
+		if selectedInstance.State != "running" {
+			var warningColor string
+			var warningMessage string
+
+			switch selectedInstance.State {
+			case "stopped", "stopping":
+				warningColor = qc.ColorRed
+				warningMessage = "⚠️  WARNING: Instance is not running - SSM connection will likely fail!"
+			case "terminated", "shutting-down":
+				warningColor = qc.ColorRed
+				if selectedInstance.State == "terminated" {
+					warningMessage = "⚠️  WARNING: Instance is terminated - SSM connection is impossible!"
+				} else {
+					warningMessage = "⚠️  WARNING: Instance is shutting down - SSM connection is impossible!"
+				}
+			case "pending", "starting":
+				warningColor = qc.ColorYellow
+				warningMessage = "⚠️  WARNING: Instance is still starting - SSM connection may not be ready yet"
+			default:
+				warningColor = qc.ColorYellow
+				warningMessage = fmt.Sprintf("⚠️  WARNING: Instance is in %s state - SSM connection may not be available", selectedInstance.State)
+			}
+
+			fmt.Printf("%s\n", color(warningMessage, warningColor))
+			fmt.Printf("%s", color("Continue anyway? (y/N): ", qc.ColorYellow))
 
-	// Start the SSM session using AWS CLI
-	if err := startSSMSession(selectedInstance.ID); err != nil {
-		log.Fatal("SSM session failed:", err)
+			confirmInput, err := readInput(reader)
+			if err != nil {
+				log.Fatal(err)
+			}
+			confirmInput = strings.TrimSpace(confirmInput)
+
+			if confirmInput != "y" && confirmInput != "Y" && confirmInput != "yes" {
+				fmt.Println("Cancelled")
+				if loopMenu {
+					continue
+				}
+				return
+			}
+		}
+
+		if diagnoseSelected {
+			// Perform diagnostic checks
+			ec2Client := ec2.NewFromConfig(cfg)
+			iamClient := iam.NewFromConfig(cfg)
+			results, err := performDiagnostics(ctx, ec2Client, iamClient, ssmClient, selectedInstance.ID, diagOpts)
+			if err != nil {
+				log.Fatal("Diagnostic check failed:", err)
+			}
+			reportConnectPermission(ctx, iamClient, derefOr(callerIdentity.Arn, ""), cfg.Region, derefOr(callerIdentity.Account, ""), selectedInstance.ID, results)
+			if *fixScript != "" {
+				reportFixScript(*fixScript, selectedInstance.ID, cfg.Region, results)
+			}
+			if loopMenu {
+				continue
+			}
+			return
+		}
+
+		if err := checkNotDenied(selectedInstance); err != nil {
+			log.Println(err)
+			if loopMenu {
+				continue
+			}
+			os.Exit(1)
+		}
+
+		if *waitOnline > 0 {
+			if err := waitForSSMOnline(ctx, ssmClient, selectedInstance.ID, *waitOnline, !*quiet && isTerminal(os.Stdout)); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if *pingSessionFlag {
+			if !reportPing(selectedInstance, *pingTimeout, sessionOpts) {
+				os.Exit(1)
+			}
+			return
+		}
+
+		// Without a mode flag, --choose-method asks how to connect.
+		forwardSpec, rdpMode := *portForward, *rdp
+		if *chooseMethod && strings.TrimSpace(forwardSpec) == "" && *recordCast == "" && interactive {
+			method, spec, err := promptForConnectMethod(reader, selectedInstance)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if method == "" {
+				if loopMenu {
+					continue
+				}
+				return
+			}
+			forwardSpec, rdpMode = spec, method == methodRDP
+		}
+
+		// Let the user know if someone else is already on the box
+		printActiveSessions(ctx, ssmClient, selectedInstance.ID)
+
+		// If port forwarding is requested, start a port forwarding session
+		if strings.TrimSpace(forwardSpec) != "" {
+			requestedPort, remotePort, err := parsePortForwardFlag(forwardSpec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			localPort, err := resolveLocalPort(requestedPort, *autoPort)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if localPort != requestedPort {
+				fmt.Println(color(fmt.Sprintf("Local port %d is in use; using %d instead", requestedPort, localPort), qc.ColorYellow))
+			}
+			remoteHost, err := selectForwardIP(reader, selectedInstance, *targetIP)
+			if err != nil {
+				log.Fatal(err)
+			}
+			destination := selectedInstance.ID
+			if remoteHost != "" {
+				destination = fmt.Sprintf("%s (%s)", selectedInstance.ID, remoteHost)
+			}
+			if rdpMode && !isWindows(selectedInstance) {
+				fmt.Println(color("⚠️  WARNING: This instance does not appear to run Windows - RDP will likely not be available", qc.ColorYellow))
+			}
+			fmt.Printf("Starting port forward %d -> %s:%d. This may take a few moments...\n", localPort, destination, remotePort)
+			if rdpMode {
+				fmt.Printf("Connect your RDP client to %s. Press Ctrl-C to close the tunnel.\n", colorBold(fmt.Sprintf("localhost:%d", localPort), qc.ColorCyan))
+			}
+			if *rdpLaunch {
+				go launchRDPWhenReady(localPort)
+			}
+			recordSession(selectedInstance, cfg.Region, callerIdentity, "port-forward", *ticket, *privateMode)
+			if err := startSSMPortForwardSession(selectedInstance.ID, localPort, remotePort, remoteHost, sessionOpts); err != nil {
+				log.Println("SSM port-forward session failed:", err)
+				if errors.Is(err, errInstanceGone) && canRepick {
+					dropGoneInstance(selectedInstance)
+					continue
+				}
+				recordFailedConnection(selectedInstance.ID, cfg.Region)
+				if !*noAutoDiagnose {
+					diagnoseFailedConnection(ctx, ec2Client, iam.NewFromConfig(cfg), ssmClient, selectedInstance.ID)
+				}
+				if !loopMenu {
+					os.Exit(1)
+				}
+			}
+			if loopMenu {
+				refreshLoopMenu()
+				continue
+			}
+			return
+		}
+
+		fmt.Println("Connecting to instance. This may take a few moments: ")
+		recordSession(selectedInstance, cfg.Region, callerIdentity, "session", *ticket, *privateMode)
+
+		// Start the SSM session using AWS CLI
+		startSession := func() error { return startSSMSession(selectedInstance.ID, sessionOpts) }
+		if *recordCast != "" {
+			path := castPath(*recordCast, selectedInstance)
+			fmt.Printf("Recording the session to %s\n", colorBold(path, qc.ColorCyan))
+			startSession = func() error { return startRecordedSSMSession(selectedInstance, path, sessionOpts) }
+		}
+		if err := startSession(); err != nil {
+			log.Println("SSM session failed:", err)
+			if errors.Is(err, errInstanceGone) && canRepick {
+				dropGoneInstance(selectedInstance)
+				continue
+			}
+			recordFailedConnection(selectedInstance.ID, cfg.Region)
+			if !*noAutoDiagnose {
+				diagnoseFailedConnection(ctx, ec2Client, iam.NewFromConfig(cfg), ssmClient, selectedInstance.ID)
+			}
+			if !loopMenu {
+				os.Exit(1)
+			}
+		}
+		if !loopMenu {
+			return
+		}
+		refreshLoopMenu()
 	}
 }
 
+// promptForInstance asks the user to pick an instance from the menu. It returns
+// nil without an error when the user chooses to exit.
+// A "?" prefix (e.g. "?3") selects the instance for diagnostics rather than
+// a session, which is reported through the diagnose return value.
+// With allowRange, selections such as "1-4" or "1,3" pick several instances,
+// e.g. to open one tunnel per instance.
+// Menus of up to singleKeyLimit entries on a terminal take a single keypress.
+func promptForInstance(reader *bufio.Reader, instances []*InstanceInfo, allowRange bool) (selected []*InstanceInfo, diagnose bool, err error) {
+	singleKey := useSingleKey(len(instances), allowRange)
+	prompt := "Select instance (prefix with ? to diagnose, e.g. ?3). Blank, or non-numeric input will exit: "
+	switch {
+	case allowRange:
+		prompt = "Select instance, or a range such as 1-4 for one tunnel each (prefix with ? to diagnose, e.g. ?3). Blank will exit: "
+	case singleKey:
+		prompt = fmt.Sprintf("Press 1-%d to select (? to diagnose, e.g. ?3). Enter or Esc will exit: ", len(instances))
+	}
+	fmt.Printf("%s", color(prompt, qc.ColorYellow))
+	var input string
+	if singleKey {
+		input, err = readSelectionKey(reader)
+	} else {
+		input, err = readInput(reader)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		fmt.Println("Exiting")
+		return nil, false, nil
+	}
+	if mode, ok := strings.CutPrefix(input, "sort"); ok && (mode == "" || mode[0] == ' ') {
+		return nil, false, &SortRequest{Mode: strings.TrimSpace(mode)}
+	}
+	if strings.HasPrefix(input, "?") {
+		diagnose = true
+		input = strings.TrimSpace(input[1:])
+	}
+	if allowRange && !diagnose && strings.ContainsAny(input, ",-") {
+		indexes, err := parseSelection(input, len(instances))
+		if err != nil {
+			return nil, false, err
+		}
+		for _, i := range indexes {
+			selected = append(selected, instances[i])
+		}
+		return selected, false, nil
+	}
+	inputInt, err := strconv.Atoi(input)
+	if err != nil {
+		fmt.Println("Non-numeric input. Exiting")
+		return nil, false, nil
+	}
+	if inputInt < 1 || inputInt > len(instances) {
+		fmt.Println("Selection out of range. Exiting")
+		return nil, false, nil
+	}
+	return []*InstanceInfo{instances[inputInt-1]}, diagnose, nil
+}
+
+// selectByIndex returns the instance shown as number n in the menu, for
+// --select. The numbering matches the menu and --porcelain output for the
+// same filters and sort order.
+func selectByIndex(instances []*InstanceInfo, n int) (*InstanceInfo, error) {
+	if n < 1 || n > len(instances) {
+		return nil, fmt.Errorf("--select %d is out of range; the menu has %d instances", n, len(instances))
+	}
+	return instances[n-1], nil
+}
+
+// filterValueLimit is the most values EC2 accepts in a single filter.
+const filterValueLimit = 200
+
 // getInstances retrieves all EC2 instances from the AWS account and returns them
 // as a sorted list of InstanceInfo structs. The function uses pagination to handle
 // accounts with large numbers of instances and extracts instance names from EC2 tags.
-func getInstances(ctx context.Context, ec2Client *ec2.Client, filterStr *string) ([]*InstanceInfo, error) {
-	paginator := ec2.NewDescribeInstancesPaginator(
-		ec2Client, &ec2.DescribeInstancesInput{},
-	)
+// If a page after the first fails, the instances collected so far are returned
+// and a warning is logged.
+func getInstances(ctx context.Context, ec2Client *ec2.Client, filter InstanceFilter) ([]*InstanceInfo, error) {
+	// EC2 caps the values in a single filter, so long ID lists are queried
+	// a chunk at a time. Like a failed page, a failed chunk only makes the
+	// list incomplete.
+	chunks := [][]string{filter.InstanceIDs}
+	if len(filter.InstanceIDs) > filterValueLimit {
+		chunks = nil
+		for start := 0; start < len(filter.InstanceIDs); start += filterValueLimit {
+			chunks = append(chunks, filter.InstanceIDs[start:min(start+filterValueLimit, len(filter.InstanceIDs))])
+		}
+	}
+	instances := []*InstanceInfo{}
+	failed := 0
+	var firstErr error
+	for _, ids := range chunks {
+		chunk := filter
+		chunk.InstanceIDs = ids
+		found, err := describeInstances(ctx, ec2Client, chunk)
+		instances = append(instances, found...)
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		if len(instances) == 0 {
+			return nil, firstErr
+		}
+		log.Printf(
+			"[WARNING]: failed to fetch %d of %d batches of instances: %v. The list below is incomplete (%d instances).",
+			failed, len(chunks), firstErr, len(instances),
+		)
+	}
+	sortInstances(instances, sortByName)
+	addInstanceDisplayNames(instances)
+
+	return instances, nil
+}
+
+// describeInstances pages through DescribeInstances for filter and returns
+// the matching instances, unsorted and without display names. If a page
+// after the first fails, the instances collected so far are returned and a
+// warning is logged.
+func describeInstances(ctx context.Context, ec2Client *ec2.Client, filter InstanceFilter) ([]*InstanceInfo, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: append([]types.Filter{}, filter.APIFilters...),
+	}
+	if len(filter.InstanceIDs) > 0 {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("instance-id"),
+			Values: filter.InstanceIDs,
+		})
+	}
+	// Spot instances can be filtered server-side. On-demand instances have no
+	// instance-lifecycle value, so they are filtered client-side below.
+	if filter.Lifecycle == "spot" {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("instance-lifecycle"),
+			Values: []string{"spot"},
+		})
+	}
+	if len(filter.States) > 0 {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("instance-state-name"),
+			Values: filter.States,
+		})
+	}
+	if filter.Arch != "" {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("architecture"),
+			Values: []string{filter.Arch},
+		})
+	}
+	if filter.Stack != "" {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("tag:" + cfnStackTag),
+			Values: []string{filter.Stack},
+		})
+	}
+	if len(filter.AMIs) > 0 {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("image-id"),
+			Values: filter.AMIs,
+		})
+	}
+	if filter.LaunchTemplate != "" {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("tag:" + launchTemplateIDTag),
+			Values: []string{filter.LaunchTemplate},
+		})
+	}
+	if filter.TemplateVersion != "" {
+		input.Filters = append(input.Filters, types.Filter{
+			Name:   stringPtr("tag:" + launchTemplateVersionTag),
+			Values: []string{filter.TemplateVersion},
+		})
+	}
+	paginator := ec2.NewDescribeInstancesPaginator(ec2Client, input)
 	instances := []*InstanceInfo{}
+	pages := 0
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, err
+			// A transient failure part-way through should not discard the
+			// instances already collected; a partial list is still useful.
+			if pages == 0 {
+				return nil, err
+			}
+			log.Printf(
+				"[WARNING]: failed to fetch page %d of instances: %v. The list below is incomplete (%d instances from %d pages).",
+				pages+1, err, len(instances), pages,
+			)
+			break
 		}
+		pages++
 		for _, i := range output.Reservations {
+			// Shared VPCs surface instances owned by other accounts.
+			ownerID := derefOr(i.OwnerId, "")
+			if filter.Owner != "" && ownerID != filter.Owner {
+				continue
+			}
 			for _, inst := range i.Instances {
 				instanceName := "unknown"
-				// Look for the "Name" tag specifically
+				tags := map[string]string{}
 				for _, tag := range inst.Tags {
-					if tag.Key != nil && *tag.Key == "Name" && tag.Value != nil {
-						instanceName = *tag.Value
-						break
+					if tag.Key != nil && tag.Value != nil {
+						tags[*tag.Key] = *tag.Value
 					}
 				}
-				if *filterStr != "" && !strings.Contains(
-					strings.ToLower(instanceName), strings.ToLower(*filterStr),
+				// Prefer the configured label tag, falling back to "Name"
+				if name, ok := tags[filter.LabelTag]; ok && filter.LabelTag != "" {
+					instanceName = name
+				} else if name, ok := tags["Name"]; ok {
+					instanceName = name
+				}
+				if filter.Name != "" && !strings.Contains(
+					strings.ToLower(instanceName), strings.ToLower(filter.Name),
 				) {
 					continue
 				}
+				if filter.Lifecycle == "ondemand" && inst.InstanceLifecycle != "" {
+					continue
+				}
+				if filter.HideTerminating && isTransitioningOut(string(inst.State.Name)) {
+					continue
+				}
+				// Exclusions are applied last and client-side since EC2
+				// filters cannot express negation.
+				if matchesAnyTag(tags, filter.ExcludeTags) {
+					continue
+				}
 
 				instances = append(instances, &InstanceInfo{
-					ID:    *inst.InstanceId,
-					Name:  instanceName,
-					State: string(inst.State.Name),
+					ID:         *inst.InstanceId,
+					Name:       instanceName,
+					State:      string(inst.State.Name),
+					Type:       string(inst.InstanceType),
+					AZ:         placementAZ(&inst),
+					Lifecycle:  string(inst.InstanceLifecycle),
+					Arch:       string(inst.Architecture),
+					ImageID:    derefOr(inst.ImageId, ""),
+					KeyName:    derefOr(inst.KeyName, ""),
+					PrivateIPs: collectPrivateIPs(inst),
+					PrivateDNS: derefOr(inst.PrivateDnsName, ""),
+					PublicDNS:  derefOr(inst.PublicDnsName, ""),
+					LaunchTime: launchTime(inst),
+					OwnerID:    ownerID,
+					Platform:   strings.ToLower(string(inst.Platform)),
+					Tags:       tags,
 				})
 			}
 		}
 	}
-	sort.Slice(instances, func(i, j int) bool {
-		if instances[i].Name == instances[j].Name {
-			return instances[i].ID < instances[j].ID
-		}
-		return instances[i].Name < instances[j].Name
-	})
-	addInstanceDisplayNames(instances)
 
 	return instances, nil
 }
 
+// isTransitioningOut reports whether state means the instance is on its way
+// down (shutting-down or stopping) and therefore not a useful target.
+func isTransitioningOut(state string) bool {
+	return state == "shutting-down" || state == "stopping"
+}
+
+// matchesAnyTag reports whether tags contain at least one of the given matches.
+func matchesAnyTag(tags map[string]string, matches []TagMatch) bool {
+	for _, m := range matches {
+		if value, ok := tags[m.Key]; ok && value == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidLifecycle reports whether value is an accepted --lifecycle option.
+func isValidLifecycle(value string) bool {
+	switch value {
+	case "spot", "ondemand", "all":
+		return true
+	default:
+		return false
+	}
+}
+
+// validArchitectures returns the architectures accepted by --arch.
+func validArchitectures() []string {
+	values := []string{}
+	for _, a := range types.ArchitectureValues("").Values() {
+		values = append(values, string(a))
+	}
+	return values
+}
+
+// allStates is the --state value that lists instances in every state.
+const allStates = "all"
+
+// parseInstanceStates parses a comma-separated --state value into EC2
+// instance state names. "all" yields nil, which disables the filter.
+func parseInstanceStates(value string) ([]string, error) {
+	valid := []string{}
+	for _, s := range types.InstanceStateName("").Values() {
+		valid = append(valid, string(s))
+	}
+	states := []string{}
+	for _, s := range strings.Split(value, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch {
+		case s == "":
+			continue
+		case s == allStates:
+			return nil, nil
+		case !slices.Contains(valid, s):
+			return nil, fmt.Errorf("--state must be %s, or a comma-separated list of: %s", allStates, strings.Join(valid, ", "))
+		}
+		states = append(states, s)
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("--state needs at least one state, or %s", allStates)
+	}
+	return states, nil
+}
+
+// isValidArch reports whether value is a known EC2 architecture.
+func isValidArch(value string) bool {
+	for _, a := range validArchitectures() {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
+
 // addInstanceDisplayNames processes a slice of InstanceInfo structs and updates
 // the DisplayName field to handle duplicate instance names by appending numbers
-// (e.g., "web-server (2)"). Instances with unique names keep their original name.
+// (e.g., "web-server (2)", or another configured duplicateNameStyle).
+// Instances with unique names keep their original name.
 func addInstanceDisplayNames(instances []*InstanceInfo) {
 	countByName := map[string]int{}
 	for i := range instances {
 		inst := instances[i]
 		countByName[inst.Name]++
 		if countByName[inst.Name] > 1 {
-			inst.DisplayName = fmt.Sprintf("%s (%d)", inst.Name, countByName[inst.Name])
+			inst.DisplayName = duplicateDisplayName(inst, countByName[inst.Name])
 		} else {
 			inst.DisplayName = inst.Name
 		}
 	}
 }
 
+// SessionOptions configures how SSM sessions are started and managed.
+type SessionOptions struct {
+	MaxDuration time.Duration // Terminate the session once it has run this long (0 = no limit)
+	Env         []string      // Extra environment entries for the aws CLI subprocess
+	ExtraArgs   []string      // Arguments passed through to aws ssm start-session
+	Reason      string        // Recorded by Session Manager as the session reason (requires --reason support)
+	Document    string        // Session document for interactive sessions (empty = Session Manager default)
+	Parameters  string        // JSON --parameters for Document, if any
+	EndpointURL string        // Custom AWS endpoint passed to the aws CLI
+	Region      string        // Region passed to the aws CLI, which otherwise uses its own default
+}
+
+// startSessionArgs returns the aws CLI arguments for start-session with the
+// tool-managed flags in base followed by the reason and pass-through args.
+func (o SessionOptions) startSessionArgs(base ...string) []string {
+	args := append([]string{"ssm", "start-session"}, base...)
+	if o.Region != "" {
+		args = append(args, "--region", o.Region)
+	}
+	if o.Reason != "" {
+		args = append(args, "--reason", o.Reason)
+	}
+	if o.EndpointURL != "" {
+		args = append(args, "--endpoint-url", o.EndpointURL)
+	}
+	return append(args, o.ExtraArgs...)
+}
+
+// sessionArgs returns the aws CLI arguments for an interactive session on
+// instanceID.
+func (o SessionOptions) sessionArgs(instanceID string) []string {
+	base := []string{"--target", instanceID}
+	if o.Document != "" {
+		base = append(base, "--document-name", o.Document)
+	}
+	if o.Parameters != "" {
+		base = append(base, "--parameters", o.Parameters)
+	}
+	return o.startSessionArgs(base...)
+}
+
+// portForwardArgs returns the aws CLI arguments for forwarding localPort to
+// remotePort on instanceID, or on remoteHost through it when set.
+func (o SessionOptions) portForwardArgs(instanceID string, localPort, remotePort int, remoteHost string) []string {
+	// Build parameters for the port forwarding document
+	// --parameters expects JSON-like arrays of strings
+	documentName := "AWS-StartPortForwardingSession"
+	params := fmt.Sprintf("portNumber=[\"%d\"],localPortNumber=[\"%d\"]", remotePort, localPort)
+	if remoteHost != "" {
+		documentName = "AWS-StartPortForwardingSessionToRemoteHost"
+		params = fmt.Sprintf("host=[\"%s\"],%s", remoteHost, params)
+	}
+	return o.startSessionArgs(
+		"--target", instanceID,
+		"--document-name", documentName,
+		"--parameters", params,
+	)
+}
+
+// environ returns the environment for the aws CLI subprocess. Later entries
+// override earlier ones, so opts.Env takes precedence over the inherited
+// environment.
+func (o SessionOptions) environ() []string {
+	return append(os.Environ(), o.Env...)
+}
+
+// deadline returns a channel that fires when MaxDuration elapses, or nil
+// (which blocks forever in a select) when no limit is set.
+func (o SessionOptions) deadline() <-chan time.Time {
+	if o.MaxDuration <= 0 {
+		return nil
+	}
+	return time.After(o.MaxDuration)
+}
+
+// Session Manager's maxSessionDuration preference accepts 1 to 1440 minutes,
+// so the same bounds are enforced for --max-duration.
+const (
+	minSessionDuration = time.Minute
+	maxSessionDuration = 24 * time.Hour
+)
+
+// parseMaxDuration parses and validates a --max-duration value.
+func parseMaxDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid max duration: %v", err)
+	}
+	if d < minSessionDuration || d > maxSessionDuration {
+		return 0, fmt.Errorf("max duration must be between %s and %s, got %s", minSessionDuration, maxSessionDuration, d)
+	}
+	return d, nil
+}
+
+// doubleInterruptWindow is how soon a second Ctrl-C must follow the first to
+// end an interactive session rather than being passed through to it.
+const doubleInterruptWindow = time.Second
+
 // startSSMSession establishes an interactive SSM session to the specified EC2 instance
 // using the AWS CLI. The function handles signal interception for graceful shutdown
 // and properly manages the subprocess lifecycle. Returns an error if the session
 // cannot be established or terminates unexpectedly.
-func startSSMSession(instanceID string) error {
-	// Set up signal handling for graceful shutdown
+func startSSMSession(instanceID string, opts SessionOptions) error {
+	// Set up signal handling for graceful shutdown. SIGWINCH is deliberately
+	// not handled: session-manager-plugin runs in the terminal's foreground
+	// process group, so the kernel already delivers resizes to it directly,
+	// and forwarding them to the aws CLI wrapper would not reach the plugin.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	// Create the AWS CLI command
-	cmd := exec.Command("aws", "ssm", "start-session", "--target", instanceID)
+	cmd := exec.Command("aws", opts.sessionArgs(instanceID)...)
+	cmd.Env = opts.environ()
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	stderr := &stderrTail{}
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 
 	// Start the process
 	if err := cmd.Start(); err != nil {
@@ -296,41 +1757,53 @@ func startSSMSession(instanceID string) error {
 		done <- cmd.Wait()
 	}()
 
-	select {
-	case <-sigChan:
-		log.Println("Received interrupt signal, terminating SSM session...")
-		cmd.Process.Signal(syscall.SIGINT)
-		<-done // Wait for the process to exit
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("SSM session ended with error: %v", err)
+	// Ctrl-C belongs to the remote shell: a single SIGINT is passed through to
+	// the session, and only a second one in quick succession tears it down.
+	deadline := opts.deadline()
+	var lastInterrupt time.Time
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGINT && time.Since(lastInterrupt) > doubleInterruptWindow {
+				lastInterrupt = time.Now()
+				cmd.Process.Signal(syscall.SIGINT)
+				continue
+			}
+			log.Println("Received interrupt signal, terminating SSM session...")
+			cmd.Process.Signal(syscall.SIGTERM)
+			<-done // Wait for the process to exit
+			return nil
+		case <-deadline:
+			log.Printf("Maximum session duration of %s reached, terminating SSM session...", opts.MaxDuration)
+			cmd.Process.Signal(syscall.SIGTERM)
+			<-done
+			return nil
+		case err := <-done:
+			if err != nil {
+				return sessionFailure("SSM session ended with error", err, stderr)
+			}
+			return nil
 		}
 	}
-
-	return nil
 }
 
 // startSSMPortForwardSession starts an SSM port forwarding session using the AWS CLI.
 // It forwards from localhost:localPort to instance:remotePort using the
-// AWS-StartPortForwardingSession document.
-func startSSMPortForwardSession(instanceID string, localPort int, remotePort int) error {
+// AWS-StartPortForwardingSession document. When remoteHost is set, the
+// AWS-StartPortForwardingSessionToRemoteHost document is used instead so traffic
+// is forwarded to remoteHost:remotePort through the instance.
+func startSSMPortForwardSession(instanceID string, localPort int, remotePort int, remoteHost string, opts SessionOptions) error {
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	// Build parameters for the port forwarding document
-	// --parameters expects JSON-like arrays of strings
-	params := fmt.Sprintf("portNumber=[\"%d\"],localPortNumber=[\"%d\"]", remotePort, localPort)
-
-	cmd := exec.Command(
-		"aws", "ssm", "start-session",
-		"--target", instanceID,
-		"--document-name", "AWS-StartPortForwardingSession",
-		"--parameters", params,
-	)
+	cmd := exec.Command("aws", opts.portForwardArgs(instanceID, localPort, remotePort, remoteHost)...)
+	cmd.Env = opts.environ()
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	stderr := &stderrTail{}
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start SSM port-forward session: %v", err)
@@ -346,15 +1819,104 @@ func startSSMPortForwardSession(instanceID string, localPort int, remotePort int
 		log.Println("Received interrupt signal, terminating SSM port-forward session...")
 		cmd.Process.Signal(syscall.SIGINT)
 		<-done
+	case <-opts.deadline():
+		log.Printf("Maximum session duration of %s reached, terminating SSM port-forward session...", opts.MaxDuration)
+		cmd.Process.Signal(syscall.SIGTERM)
+		<-done
 	case err := <-done:
 		if err != nil {
-			return fmt.Errorf("SSM port-forward session ended with error: %v", err)
+			return sessionFailure("SSM port-forward session ended with error", err, stderr)
 		}
 	}
 
 	return nil
 }
 
+// launchTime returns the instance's launch time, or the zero time if unknown.
+func launchTime(inst types.Instance) time.Time {
+	if inst.LaunchTime == nil {
+		return time.Time{}
+	}
+	return *inst.LaunchTime
+}
+
+// collectPrivateIPs returns every private IP assigned to the instance's network
+// interfaces. The instance's primary private IP is always listed first.
+func collectPrivateIPs(inst types.Instance) []string {
+	ips := []string{}
+	seen := map[string]bool{}
+	if inst.PrivateIpAddress != nil && *inst.PrivateIpAddress != "" {
+		ips = append(ips, *inst.PrivateIpAddress)
+		seen[*inst.PrivateIpAddress] = true
+	}
+	enis := append([]types.InstanceNetworkInterface{}, inst.NetworkInterfaces...)
+	sort.SliceStable(enis, func(i, j int) bool {
+		return eniDeviceIndex(enis[i]) < eniDeviceIndex(enis[j])
+	})
+	for _, eni := range enis {
+		for _, addr := range eni.PrivateIpAddresses {
+			if addr.PrivateIpAddress == nil || seen[*addr.PrivateIpAddress] {
+				continue
+			}
+			ips = append(ips, *addr.PrivateIpAddress)
+			seen[*addr.PrivateIpAddress] = true
+		}
+	}
+	return ips
+}
+
+func eniDeviceIndex(eni types.InstanceNetworkInterface) int32 {
+	if eni.Attachment == nil || eni.Attachment.DeviceIndex == nil {
+		return 0
+	}
+	return *eni.Attachment.DeviceIndex
+}
+
+// selectForwardIP determines which private IP a port forward should target.
+// An explicit targetIP always wins. Otherwise, when the instance has more than
+// one private IP, the user is prompted to choose one. An empty return value
+// means the instance's primary IP, which needs no remote-host forwarding.
+func selectForwardIP(reader *bufio.Reader, instance *InstanceInfo, targetIP string) (string, error) {
+	if targetIP = strings.TrimSpace(targetIP); targetIP != "" {
+		if net.ParseIP(targetIP) == nil {
+			return "", fmt.Errorf("invalid target IP: %s", targetIP)
+		}
+		if len(instance.PrivateIPs) > 0 && targetIP == instance.PrivateIPs[0] {
+			return "", nil
+		}
+		return targetIP, nil
+	}
+	if len(instance.PrivateIPs) <= 1 || !interactive {
+		return "", nil
+	}
+
+	fmt.Println("Instance has multiple private IPs:")
+	for i, ip := range instance.PrivateIPs {
+		label := ""
+		if i == 0 {
+			label = color(" (primary)", qc.ColorGreen)
+		}
+		fmt.Printf("%3d. %s%s\n", i+1, ip, label)
+	}
+	fmt.Printf("%s", color("Select IP to forward to. Blank uses the primary: ", qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return "", err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", nil
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > len(instance.PrivateIPs) {
+		return "", fmt.Errorf("invalid IP selection: %s", input)
+	}
+	if choice == 1 {
+		return "", nil
+	}
+	return instance.PrivateIPs[choice-1], nil
+}
+
 // parsePortForwardFlag parses values like "80" (local=80, remote=80) or
 // "8080:80" (local=8080, remote=80).
 func parsePortForwardFlag(value string) (int, int, error) {
@@ -388,46 +1950,102 @@ func parsePortForwardFlag(value string) (int, int, error) {
 
 // DiagnosticResult represents the result of a diagnostic check
 type DiagnosticResult struct {
-	CheckName string
-	Status    string // "PASS", "FAIL", "WARN"
-	Message   string
+	CheckName   string   `json:"check"`
+	Status      string   `json:"status"` // "PASS", "FAIL", "WARN"
+	Message     string   `json:"message"`
+	Remediation []string `json:"remediation,omitempty"` // AWS CLI commands that would fix a FAIL, if known
+}
+
+// Keys accepted by --only to select individual diagnostic checks.
+const (
+	checkKeyState    = "state"
+	checkKeyIAM      = "iam"
+	checkKeyInternet = "internet"
+	checkKeySSM      = "ssm"
+	checkKeyDNS      = "dns"
+	checkKeyNACL     = "nacl"
+	checkKeyAgent    = "agent"
+	checkKeyMetadata = "metadata"
+)
+
+// DiagnosticOptions enables optional diagnostic checks.
+type DiagnosticOptions struct {
+	RequireMetadataTags bool     // Check that tags are readable from instance metadata
+	Only                []string // Run only these checks (see checkNames); empty runs all
+	SummaryOnly         bool     // Print only the summary block, not each check
+}
+
+// enabled reports whether the check identified by key should run.
+func (o DiagnosticOptions) enabled(key string) bool {
+	if len(o.Only) == 0 {
+		return true
+	}
+	for _, k := range o.Only {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 // performDiagnostics runs comprehensive diagnostic checks on the specified instance
 // including IAM role attachment, internet connectivity, and SSM traffic requirements.
-func performDiagnostics(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, instanceID string) error {
-	fmt.Printf("\n%s\n", qc.Color(strings.Repeat("=", 60), qc.ColorBlue))
-	fmt.Printf("%s\n", qc.ColorizeBold("DIAGNOSTIC CHECKS FOR INSTANCE: "+qc.Color(instanceID, qc.ColorWhite), qc.ColorBlue))
-	fmt.Printf("%s\n", qc.Color(strings.Repeat("=", 60), qc.ColorBlue))
-
-	var results []DiagnosticResult
+// The individual results are returned so callers can act on them.
+func performDiagnostics(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, ssmClient *ssm.Client, instanceID string, opts DiagnosticOptions) ([]DiagnosticResult, error) {
+	fmt.Printf("\n%s\n", color(strings.Repeat("=", 60), qc.ColorBlue))
+	fmt.Printf("%s\n", colorBold("DIAGNOSTIC CHECKS FOR INSTANCE: "+color(instanceID, qc.ColorWhite), qc.ColorBlue))
+	fmt.Printf("%s\n", color(strings.Repeat("=", 60), qc.ColorBlue))
 
-	// Get instance details
-	instance, err := getInstanceDetails(ctx, ec2Client, instanceID)
+	results, err := runDiagnostics(ctx, ec2Client, iamClient, ssmClient, instanceID, opts)
 	if err != nil {
-		return fmt.Errorf("failed to get instance details: %v", err)
+		return nil, err
 	}
 
-	// Check 1: Instance State
-	stateResult := checkInstanceState(instance)
-	results = append(results, stateResult)
+	// Display results
+	displayDiagnosticResults(results, opts.SummaryOnly)
 
-	// Check 2: IAM Role Attachment
-	iamResult := checkIAMRole(ctx, iamClient, instance)
-	results = append(results, iamResult)
+	return results, nil
+}
 
-	// Check 3: Internet Connectivity
-	internetResult := checkInternetConnectivity(ctx, ec2Client, instance)
-	results = append(results, internetResult)
+// runDiagnostics runs the diagnostic checks against the instance without
+// printing anything, so it can be used for single instances and fleet scans.
+func runDiagnostics(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, ssmClient *ssm.Client, instanceID string, opts DiagnosticOptions) ([]DiagnosticResult, error) {
+	// Get instance details
+	instance, err := getInstanceDetails(ctx, ec2Client, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance details: %v", err)
+	}
+	return runDiagnosticsOn(ctx, ec2Client, iamClient, ssmClient, instance, opts), nil
+}
 
-	// Check 4: SSM Traffic Rules
-	ssmResult := checkSSMTrafficRules(ctx, ec2Client, instance)
-	results = append(results, ssmResult)
+// runDiagnosticsOn runs the diagnostic checks like runDiagnostics against
+// instance details the caller already fetched.
+func runDiagnosticsOn(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, ssmClient *ssm.Client, instance *types.Instance, opts DiagnosticOptions) []DiagnosticResult {
+	var results []DiagnosticResult
+	clients := DiagnosticClients{EC2: ec2Client, IAM: iamClient, SSM: ssmClient, Instance: instance}
+	for _, check := range diagnosticChecks {
+		if !opts.enabled(check.Name()) {
+			continue
+		}
+		if c, ok := check.(optInCheck); ok && !c.enabledBy(opts) {
+			continue
+		}
+		results = append(results, check.Run(ctx, clients))
+	}
+	if result, ok := correlateNetworkAndAgent(ctx, ssmClient, instance, results); ok {
+		results = append(results, result)
+	}
 
-	// Display results
-	displayDiagnosticResults(results)
+	return results
+}
 
-	return nil
+// diagnoseFailedConnection runs the diagnostic checks after a failed
+// connection attempt so the user immediately sees the likely cause.
+func diagnoseFailedConnection(ctx context.Context, ec2Client *ec2.Client, iamClient *iam.Client, ssmClient *ssm.Client, instanceID string) {
+	fmt.Println(color("Running diagnostics to explain the failure (disable with --no-auto-diagnose)...", qc.ColorYellow))
+	if _, err := performDiagnostics(ctx, ec2Client, iamClient, ssmClient, instanceID, DiagnosticOptions{}); err != nil {
+		log.Println("Diagnostic check failed:", err)
+	}
 }
 
 // getInstanceDetails retrieves detailed information about a specific EC2 instance
@@ -462,6 +2080,9 @@ func checkInstanceState(instance *types.Instance) DiagnosticResult {
 			CheckName: "Instance State",
 			Status:    "FAIL",
 			Message:   fmt.Sprintf("Instance is %s - cannot connect via SSM", state),
+			Remediation: []string{
+				fmt.Sprintf("aws ec2 start-instances --instance-ids %s", *instance.InstanceId),
+			},
 		}
 	case "terminated":
 		return DiagnosticResult{
@@ -490,6 +2111,26 @@ func checkInstanceState(instance *types.Instance) DiagnosticResult {
 	}
 }
 
+// checkInstanceMetadataTags verifies that tags can be read from the instance
+// metadata service, which on-instance tooling may rely on.
+func checkInstanceMetadataTags(instance *types.Instance) DiagnosticResult {
+	if instance.MetadataOptions != nil && instance.MetadataOptions.InstanceMetadataTags == types.InstanceMetadataTagsStateEnabled {
+		return DiagnosticResult{
+			CheckName: "Instance Metadata Tags",
+			Status:    "PASS",
+			Message:   "Instance metadata tags are enabled",
+		}
+	}
+	return DiagnosticResult{
+		CheckName: "Instance Metadata Tags",
+		Status:    "WARN",
+		Message:   "Instance metadata tags are disabled - tools on the instance cannot read its tags from IMDS",
+		Remediation: []string{
+			fmt.Sprintf("aws ec2 modify-instance-metadata-options --instance-id %s --instance-metadata-tags enabled", *instance.InstanceId),
+		},
+	}
+}
+
 // checkIAMRole verifies if the instance has an IAM role attached with SSM permissions
 func checkIAMRole(ctx context.Context, iamClient *iam.Client, instance *types.Instance) DiagnosticResult {
 	if instance.IamInstanceProfile == nil || instance.IamInstanceProfile.Arn == nil {
@@ -497,6 +2138,10 @@ func checkIAMRole(ctx context.Context, iamClient *iam.Client, instance *types.In
 			CheckName: "IAM Role Attachment",
 			Status:    "FAIL",
 			Message:   "No IAM instance profile attached to the instance",
+			Remediation: []string{
+				"# Replace PROFILE_NAME with an instance profile whose role has AmazonSSMManagedInstanceCore attached",
+				fmt.Sprintf("aws ec2 associate-iam-instance-profile --instance-id %s --iam-instance-profile Name=PROFILE_NAME", *instance.InstanceId),
+			},
 		}
 	}
 
@@ -513,6 +2158,14 @@ func checkIAMRole(ctx context.Context, iamClient *iam.Client, instance *types.In
 
 	// Check if role has SSM permissions
 	hasSSMPermissions, err := checkRoleSSMPermissions(ctx, iamClient, roleName)
+	var permErr *MissingPermissionError
+	if errors.As(err, &permErr) {
+		return DiagnosticResult{
+			CheckName: "IAM Role Attachment",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("IAM role '%s' attached but cannot verify its SSM permissions: your credentials lack %s", roleName, permErr.Action),
+		}
+	}
 	if err != nil {
 		return DiagnosticResult{
 			CheckName: "IAM Role Attachment",
@@ -533,6 +2186,9 @@ func checkIAMRole(ctx context.Context, iamClient *iam.Client, instance *types.In
 		CheckName: "IAM Role Attachment",
 		Status:    "FAIL",
 		Message:   fmt.Sprintf("IAM role '%s' attached but missing required SSM permissions", roleName),
+		Remediation: []string{
+			fmt.Sprintf("aws iam attach-role-policy --role-name %s --policy-arn arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore", roleName),
+		},
 	}
 }
 
@@ -586,26 +2242,44 @@ func checkInternetConnectivity(ctx context.Context, ec2Client *ec2.Client, insta
 		}
 	}
 
-	hasInternetRoute := false
-	for _, rt := range routeTables.RouteTables {
-		// Check if this route table is associated with the subnet
-		associatedWithSubnet := false
-		for _, assoc := range rt.Associations {
-			if assoc.SubnetId != nil && *assoc.SubnetId == *instance.SubnetId {
-				associatedWithSubnet = true
-				break
-			}
+	rt, viaMain := effectiveRouteTable(routeTables.RouteTables, *instance.SubnetId)
+	if rt == nil {
+		considered := []string{}
+		for _, table := range routeTables.RouteTables {
+			considered = append(considered, derefOr(table.RouteTableId, ""))
+		}
+		if len(considered) == 0 {
+			considered = append(considered, "none")
+		}
+		return DiagnosticResult{
+			CheckName: "Internet Connectivity",
+			Status:    "WARN",
+			Message: fmt.Sprintf(
+				"Could not determine the route table for subnet %s (no explicit association and no main route table found; considered %s)",
+				*instance.SubnetId, strings.Join(considered, ", "),
+			),
 		}
+	}
+	// Subnets without an explicit association use the VPC's main table.
+	source := ""
+	if viaMain {
+		source = fmt.Sprintf(" via main route table %s", derefOr(rt.RouteTableId, ""))
+	}
 
-		if associatedWithSubnet {
-			// Check for 0.0.0.0/0 route to internet gateway
-			for _, route := range rt.Routes {
-				if route.DestinationCidrBlock != nil && *route.DestinationCidrBlock == "0.0.0.0/0" {
-					if route.GatewayId != nil && strings.HasPrefix(*route.GatewayId, "igw-") {
-						hasInternetRoute = true
-						break
-					}
-				}
+	hasInternetRoute := false
+	transitGateways := []string{}
+	for _, route := range rt.Routes {
+		// In hub-and-spoke networks, SSM may be reached through a
+		// transit gateway, by default route or by a route to the
+		// hub VPC holding the SSM endpoints.
+		if tgw := derefOr(route.TransitGatewayId, ""); tgw != "" && !slices.Contains(transitGateways, tgw) {
+			transitGateways = append(transitGateways, tgw)
+		}
+		// Check for 0.0.0.0/0 route to internet gateway
+		if route.DestinationCidrBlock != nil && *route.DestinationCidrBlock == "0.0.0.0/0" {
+			if route.GatewayId != nil && strings.HasPrefix(*route.GatewayId, "igw-") {
+				hasInternetRoute = true
+				break
 			}
 		}
 	}
@@ -614,15 +2288,45 @@ func checkInternetConnectivity(ctx context.Context, ec2Client *ec2.Client, insta
 		return DiagnosticResult{
 			CheckName: "Internet Connectivity",
 			Status:    "PASS",
-			Message:   "Subnet has internet gateway route (0.0.0.0/0)",
+			Message:   "Subnet has internet gateway route (0.0.0.0/0)" + source,
+		}
+	}
+
+	if len(transitGateways) > 0 {
+		return DiagnosticResult{
+			CheckName: "Internet Connectivity",
+			Status:    "WARN",
+			Message: fmt.Sprintf(
+				"Subnet routes through transit gateway %s%s - connectivity depends on the attached network reaching SSM (via NAT or SSM VPC endpoints), which cannot be verified from here",
+				strings.Join(transitGateways, ", "), source,
+			),
 		}
 	}
 
 	return DiagnosticResult{
-		CheckName: "Internet Connectivity",
-		Status:    "FAIL",
-		Message:   "Subnet lacks internet gateway route (0.0.0.0/0) - instance may not have internet access",
+		CheckName:   "Internet Connectivity",
+		Status:      "FAIL",
+		Message:     "Subnet lacks internet gateway route (0.0.0.0/0)" + source + " - instance may not have internet access",
+		Remediation: ssmEndpointCommands(ec2Client.Options().Region, vpcID, *instance.SubnetId, instance.SecurityGroups),
+	}
+}
+
+// effectiveRouteTable returns the route table that applies to subnetID: the
+// one explicitly associated with it, or else the VPC's main route table, in
+// which case viaMain is true. It returns nil if neither is among tables.
+func effectiveRouteTable(tables []types.RouteTable, subnetID string) (rt *types.RouteTable, viaMain bool) {
+	var main *types.RouteTable
+	for i := range tables {
+		for _, assoc := range tables[i].Associations {
+			if derefOr(assoc.SubnetId, "") == subnetID {
+				return &tables[i], false
+			}
+			if assoc.Main != nil && *assoc.Main {
+				main = &tables[i]
+			}
+		}
 	}
+	return main, main != nil
 }
 
 // checkSSMTrafficRules verifies security group rules allow SSM traffic
@@ -708,6 +2412,70 @@ func checkSSMTrafficRules(ctx context.Context, ec2Client *ec2.Client, instance *
 		CheckName: "SSM Traffic Rules",
 		Status:    "FAIL",
 		Message:   "Security groups do not allow HTTPS outbound traffic (required for SSM)",
+		Remediation: []string{
+			fmt.Sprintf("aws ec2 authorize-security-group-egress --group-id %s --ip-permissions 'IpProtocol=tcp,FromPort=443,ToPort=443,IpRanges=[{CidrIp=0.0.0.0/0}]'", securityGroupIds[0]),
+		},
+	}
+}
+
+// checkVPCDNS verifies the instance's VPC can resolve the SSM endpoints.
+// With enableDnsSupport disabled the agent cannot register, which the route
+// and security group checks do not reveal.
+func checkVPCDNS(ctx context.Context, ec2Client *ec2.Client, instance *types.Instance) DiagnosticResult {
+	if instance.VpcId == nil {
+		return DiagnosticResult{
+			CheckName: "VPC DNS Resolution",
+			Status:    "WARN",
+			Message:   "Instance has no VPC ID",
+		}
+	}
+	vpcID := *instance.VpcId
+
+	supportAttr, err := ec2Client.DescribeVpcAttribute(ctx, &ec2.DescribeVpcAttributeInput{
+		VpcId:     &vpcID,
+		Attribute: types.VpcAttributeNameEnableDnsSupport,
+	})
+	if err != nil {
+		return DiagnosticResult{
+			CheckName: "VPC DNS Resolution",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("Could not check DNS support for VPC %s: %v", vpcID, err),
+		}
+	}
+	if supportAttr.EnableDnsSupport == nil || supportAttr.EnableDnsSupport.Value == nil || !*supportAttr.EnableDnsSupport.Value {
+		return DiagnosticResult{
+			CheckName: "VPC DNS Resolution",
+			Status:    "FAIL",
+			Message:   fmt.Sprintf("DNS support is disabled for VPC %s - the SSM agent cannot resolve its endpoints", vpcID),
+			Remediation: []string{
+				fmt.Sprintf(`aws ec2 modify-vpc-attribute --vpc-id %s --enable-dns-support '{"Value":true}'`, vpcID),
+			},
+		}
+	}
+
+	hostnamesAttr, err := ec2Client.DescribeVpcAttribute(ctx, &ec2.DescribeVpcAttributeInput{
+		VpcId:     &vpcID,
+		Attribute: types.VpcAttributeNameEnableDnsHostnames,
+	})
+	if err != nil {
+		return DiagnosticResult{
+			CheckName: "VPC DNS Resolution",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("DNS support is enabled for VPC %s but DNS hostnames could not be checked: %v", vpcID, err),
+		}
+	}
+	if hostnamesAttr.EnableDnsHostnames == nil || hostnamesAttr.EnableDnsHostnames.Value == nil || !*hostnamesAttr.EnableDnsHostnames.Value {
+		return DiagnosticResult{
+			CheckName: "VPC DNS Resolution",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("DNS hostnames are disabled for VPC %s - private DNS for SSM VPC endpoints will not work", vpcID),
+		}
+	}
+
+	return DiagnosticResult{
+		CheckName: "VPC DNS Resolution",
+		Status:    "PASS",
+		Message:   fmt.Sprintf("DNS support and hostnames are enabled for VPC %s", vpcID),
 	}
 }
 
@@ -715,11 +2483,11 @@ func checkSSMTrafficRules(ctx context.Context, ec2Client *ec2.Client, instance *
 
 func extractRoleNameFromProfileArn(arn string) string {
 	// ARN format: arn:aws:iam::account:instance-profile/profile-name
-	parts := strings.Split(arn, "/")
-	if len(parts) >= 2 {
-		return parts[len(parts)-1]
+	parsed, err := parseARN(arn)
+	if err != nil {
+		return ""
 	}
-	return ""
+	return parsed.ResourceName()
 }
 
 func checkRoleSSMPermissions(ctx context.Context, iamClient *iam.Client, roleName string) (bool, error) {
@@ -728,7 +2496,7 @@ func checkRoleSSMPermissions(ctx context.Context, iamClient *iam.Client, roleNam
 		RoleName: &roleName,
 	})
 	if err != nil {
-		return false, err
+		return false, wrapAccessDenied(err, "iam:ListAttachedRolePolicies")
 	}
 
 	// Check for AmazonSSMManagedInstanceCore policy
@@ -743,7 +2511,7 @@ func checkRoleSSMPermissions(ctx context.Context, iamClient *iam.Client, roleNam
 		RoleName: &roleName,
 	})
 	if err != nil {
-		return false, err
+		return false, wrapAccessDenied(err, "iam:ListRolePolicies")
 	}
 
 	for _, policyName := range inlinePolicies.PolicyNames {
@@ -752,6 +2520,9 @@ func checkRoleSSMPermissions(ctx context.Context, iamClient *iam.Client, roleNam
 			PolicyName: &policyName,
 		})
 		if err != nil {
+			if isAccessDenied(err) {
+				return false, wrapAccessDenied(err, "iam:GetRolePolicy")
+			}
 			continue
 		}
 
@@ -770,24 +2541,43 @@ func stringPtr(s string) *string {
 
 // color helpers are provided by quick_color
 
-func printHeader(checkMode bool, privateMode bool, callerIdentity *sts.GetCallerIdentityOutput) {
+// printHeader prints the banner with the caller's account and identity. When
+// credentialSource is non-empty it is shown as well, even in private mode.
+func printHeader(checkMode bool, privateMode bool, callerIdentity *sts.GetCallerIdentityOutput, credentialSource string, env, envColor string) {
+	fmt.Println(formatHeader(checkMode, privateMode, callerIdentity, credentialSource, env, envColor))
+}
+
+// formatHeader builds the header printed by printHeader. Identity fields the
+// caller identity lacks are shown as "unknown".
+func formatHeader(checkMode bool, privateMode bool, callerIdentity *sts.GetCallerIdentityOutput, credentialSource string, env, envColor string) string {
 	header := []string{
-		qc.Color(strings.Repeat("-", 40), qc.ColorBlue),
+		color(strings.Repeat("-", 40), envColor),
 		"-- SSM Quick Connect --",
-		qc.Color(strings.Repeat("-", 40), qc.ColorBlue),
+		color(strings.Repeat("-", 40), envColor),
+	}
+	if env != "" {
+		header = append(header, environmentBanner(env, envColor))
 	}
 	if checkMode {
-		header = append(header, qc.ColorizeBold("<> <> DIAGNOSTIC MODE <> <>", qc.ColorCyan))
+		header = append(header, colorBold("<> <> DIAGNOSTIC MODE <> <>", qc.ColorCyan))
 	}
 	if !privateMode {
-		header = append(header, fmt.Sprintf(
+		identity := fmt.Sprintf(
 			"  Account: %s \n  User: %s",
-			*callerIdentity.Account, *callerIdentity.Arn,
-		))
-		header = append(header, qc.Color(strings.Repeat("-", 40), qc.ColorBlue))
+			derefOr(callerIdentity.Account, "unknown"), derefOr(callerIdentity.Arn, "unknown"),
+		)
+		if env != "" {
+			identity = color(identity, envColor)
+		}
+		header = append(header, identity)
 	}
-
-	fmt.Println(strings.Join(header, "\n"))
+	if credentialSource != "" {
+		header = append(header, "  Credentials: "+credentialSource)
+	}
+	if !privateMode || credentialSource != "" || env != "" {
+		header = append(header, color(strings.Repeat("-", 40), envColor))
+	}
+	return strings.Join(header, "\n")
 }
 
 func colorInstState(state string) string {
@@ -811,58 +2601,79 @@ func colorInstState(state string) string {
 	}
 }
 
-func displayDiagnosticResults(results []DiagnosticResult) {
-	fmt.Println()
+// countResults tallies the PASS, WARN, and FAIL results.
+func countResults(results []DiagnosticResult) (pass, warn, fail int) {
 	for _, result := range results {
-		var statusIcon, colorCode string
 		switch result.Status {
 		case "PASS":
-			statusIcon = "✅"
-			colorCode = qc.ColorGreen
+			pass++
 		case "FAIL":
-			statusIcon = "❌"
-			colorCode = qc.ColorRed
+			fail++
 		case "WARN":
-			statusIcon = "⚠️"
-			colorCode = qc.ColorYellow
-		default:
-			statusIcon = "❓"
-			colorCode = qc.ColorWhite
+			warn++
 		}
+	}
+	return pass, warn, fail
+}
+
+// displayDiagnosticResults prints each check result followed by the summary
+// block. With summaryOnly, only the counts and verdict are printed so fleet
+// runs and CI logs stay compact.
+func displayDiagnosticResults(results []DiagnosticResult, summaryOnly bool) {
+	if !summaryOnly {
+		fmt.Println()
+		for _, result := range results {
+			var statusIcon, colorCode string
+			switch result.Status {
+			case "PASS":
+				statusIcon = "✅"
+				colorCode = qc.ColorGreen
+			case "FAIL":
+				statusIcon = "❌"
+				colorCode = qc.ColorRed
+			case "WARN":
+				statusIcon = "⚠️"
+				colorCode = qc.ColorYellow
+			default:
+				statusIcon = "❓"
+				colorCode = qc.ColorWhite
+			}
 
-		fmt.Printf("%s %s: %s\n", statusIcon, qc.ColorizeBold(result.CheckName, colorCode), result.Message)
+			fmt.Printf("%s %s: %s\n", statusIcon, colorBold(result.CheckName, colorCode), result.Message)
+		}
 	}
 
-	fmt.Printf("\n%s\n", qc.Color(strings.Repeat("=", 60), qc.ColorPurple))
-	fmt.Printf("%s\n", qc.ColorizeBold("DIAGNOSTIC SUMMARY", qc.ColorPurple))
-	fmt.Printf("%s\n", qc.Color(strings.Repeat("=", 60), qc.ColorPurple))
+	fmt.Printf("\n%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
+	fmt.Printf("%s\n", colorBold("DIAGNOSTIC SUMMARY", qc.ColorPurple))
+	fmt.Printf("%s\n", color(strings.Repeat("=", 60), qc.ColorPurple))
 
-	passCount := 0
-	failCount := 0
-	warnCount := 0
+	passCount, warnCount, failCount := countResults(results)
 
-	for _, result := range results {
-		switch result.Status {
-		case "PASS":
-			passCount++
-		case "FAIL":
-			failCount++
-		case "WARN":
-			warnCount++
+	fmt.Printf("%s %s\n", color("✅ Passed:", qc.ColorGreen), colorBold(fmt.Sprintf("%d", passCount), qc.ColorGreen))
+	fmt.Printf("%s %s\n", color("⚠️  Warnings:", qc.ColorYellow), colorBold(fmt.Sprintf("%d", warnCount), qc.ColorYellow))
+	fmt.Printf("%s %s\n", color("❌ Failed:", qc.ColorRed), colorBold(fmt.Sprintf("%d", failCount), qc.ColorRed))
+
+	if summaryOnly {
+		switch {
+		case failCount > 0:
+			fmt.Printf("\n%s\n", color("❌ FAIL "+failedCheckNames(results), qc.ColorRed))
+		case warnCount > 0:
+			fmt.Printf("\n%s\n", color("⚠️  WARN", qc.ColorYellow))
+		default:
+			fmt.Printf("\n%s\n", color("✅ PASS", qc.ColorGreen))
 		}
+		return
 	}
 
-	fmt.Printf("%s✅ Passed: %s\n", qc.ColorGreen, qc.ColorizeBold(fmt.Sprintf("%d", passCount), qc.ColorGreen))
-	fmt.Printf("%s⚠️  Warnings: %s\n", qc.ColorYellow, qc.ColorizeBold(fmt.Sprintf("%d", warnCount), qc.ColorYellow))
-	fmt.Printf("%s❌ Failed: %s\n", qc.ColorRed, qc.ColorizeBold(fmt.Sprintf("%d", failCount), qc.ColorRed))
-
 	if failCount == 0 && warnCount == 0 {
-		fmt.Printf("\n%s\n", qc.Color("🎉 All checks passed! Instance should be ready for SSM connection.", qc.ColorGreen))
+		fmt.Printf("\n%s\n", color("🎉 All checks passed! The instance should be ready for SSM connections.", qc.ColorGreen))
 	} else if failCount > 0 {
-		fmt.Printf("\n%s\n", qc.Color("⚠️  Some checks failed. Please address the issues above before connecting.", qc.ColorRed))
+		fmt.Printf("\n%s\n", color("⚠️  Some checks failed. Please address the issues above before connecting.", qc.ColorRed))
 	} else {
-		fmt.Printf("\n%s\n", qc.Color("⚠️  Some warnings detected. Instance may work but review the warnings above.", qc.ColorYellow))
+		fmt.Printf("\n%s\n", color("⚠️  Some warnings detected. Instance may work but review the warnings above.", qc.ColorYellow))
 	}
+
+	printExplanation(results)
 }
 
 // resolveVersion returns the version string. If ldflags-injected version is empty,
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func TestFormatHeaderNilIdentityFields(t *testing.T) {
+	header := formatHeader(false, false, &sts.GetCallerIdentityOutput{}, "", "", "")
+	for _, want := range []string{"Account: unknown", "User: unknown"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header missing %q:\n%s", want, header)
+		}
+	}
+}
+
+func TestParseInstanceStates(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "running", want: []string{"running"}},
+		{value: "Running, STOPPED", want: []string{"running", "stopped"}},
+		{value: "running,,pending", want: []string{"running", "pending"}},
+		{value: "all", want: nil},
+		{value: "running,all", want: nil},
+		{value: "", wantErr: true},
+		{value: " , ", wantErr: true},
+		{value: "asleep", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseInstanceStates(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseInstanceStates(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseInstanceStates(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEffectiveRouteTable(t *testing.T) {
+	explicit := types.RouteTable{
+		RouteTableId: aws.String("rtb-explicit"),
+		Associations: []types.RouteTableAssociation{{SubnetId: aws.String("subnet-a")}},
+	}
+	mainTable := types.RouteTable{
+		RouteTableId: aws.String("rtb-main"),
+		Associations: []types.RouteTableAssociation{{Main: aws.Bool(true)}},
+	}
+	notMain := types.RouteTable{
+		RouteTableId: aws.String("rtb-other"),
+		Associations: []types.RouteTableAssociation{{Main: aws.Bool(false)}},
+	}
+	tests := []struct {
+		name        string
+		tables      []types.RouteTable
+		subnetID    string
+		wantID      string
+		wantViaMain bool
+	}{
+		{name: "explicit association", tables: []types.RouteTable{mainTable, explicit}, subnetID: "subnet-a", wantID: "rtb-explicit"},
+		{name: "falls back to main", tables: []types.RouteTable{explicit, mainTable}, subnetID: "subnet-b", wantID: "rtb-main", wantViaMain: true},
+		{name: "Main false is ignored", tables: []types.RouteTable{notMain}, subnetID: "subnet-b"},
+		{name: "no tables", subnetID: "subnet-a"},
+	}
+	for _, tt := range tests {
+		rt, viaMain := effectiveRouteTable(tt.tables, tt.subnetID)
+		gotID := ""
+		if rt != nil {
+			gotID = aws.ToString(rt.RouteTableId)
+		}
+		if gotID != tt.wantID || viaMain != tt.wantViaMain {
+			t.Errorf("%s: effectiveRouteTable() = %q, %v, want %q, %v", tt.name, gotID, viaMain, tt.wantID, tt.wantViaMain)
+		}
+	}
+}
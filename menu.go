@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// cfnStackTag is the tag CloudFormation applies to the resources it creates.
+const cfnStackTag = "aws:cloudformation:stack-name"
+
+// MenuOptions controls the optional columns shown in the instance menu.
+type MenuOptions struct {
+	ShowStack   bool   // Show the CloudFormation stack name column
+	ShowArch    bool   // Show the CPU architecture column
+	ShowKey     bool   // Show the SSH key pair column
+	ShowAMI     bool   // Show the AMI ID column
+	ShowMetrics bool   // Show the CPU utilization column (requires loaded metrics)
+	Columns     int    // Number of menu columns; 0 fits as many as the terminal allows
+	Annotate    bool   // Append why running instances are not connectable (requires loaded SSM status)
+	Highlight   string // Case-insensitive substring to highlight in names, e.g. the --filter value
+}
+
+// menuColumnGap separates menu columns in multi-column layouts.
+const menuColumnGap = "  "
+
+// parseColumnsFlag parses a --columns value: a positive number or "auto".
+func parseColumnsFlag(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "auto" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("--columns must be a positive number or auto")
+	}
+	return n, nil
+}
+
+// printInstanceMenu prints the numbered instance menu with alternating row
+// colors and color-coded instance states. With more than one column the
+// entries are laid out top-to-bottom, then left-to-right, like ls.
+func printInstanceMenu(instances []*InstanceInfo, opts MenuOptions) {
+	longestName, longestKey := 0, 1
+	for _, inst := range instances {
+		if len(inst.DisplayName) > longestName {
+			longestName = len(inst.DisplayName)
+		}
+		longestKey = max(longestKey, len(inst.KeyName))
+	}
+
+	entries := make([]string, len(instances))
+	widths := make([]int, len(instances))
+	cellWidth := 0
+	for i, inst := range instances {
+		// Alternate row colors for better readability
+		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+
+		// Color code the state
+		stateColor := colorInstState(inst.State)
+		name := highlightMatch(inst.DisplayName, opts.Highlight) + strings.Repeat(" ", longestName-len(inst.DisplayName))
+		entry := fmt.Sprintf("%3d. %s %s [", i+1, name, inst.ID) + color(inst.State, stateColor) + "]"
+		width := len(fmt.Sprintf("%3d. %-*s %s [", i+1, longestName, inst.DisplayName, inst.ID)) + len(inst.State) + 1
+		if opts.ShowArch {
+			entry += " " + color(fmt.Sprintf("%-6s", inst.Arch), qc.ColorBlue)
+			width += 1 + max(len(inst.Arch), 6)
+		}
+		if opts.ShowAMI {
+			entry += " " + color(inst.ImageID, qc.ColorBlue)
+			width += 1 + len(inst.ImageID)
+		}
+		if opts.ShowKey {
+			keyName := inst.KeyName
+			if keyName == "" {
+				keyName = "-"
+			}
+			entry += " " + color(fmt.Sprintf("%-*s", longestKey, keyName), qc.ColorBlue)
+			width += 1 + longestKey
+		}
+		if opts.ShowMetrics {
+			cpu := formatCPU(inst)
+			entry += " " + color(cpu, qc.ColorBlue)
+			width += 1 + len(cpu)
+		}
+		if opts.ShowStack {
+			entry += " " + color(inst.Tags[cfnStackTag], qc.ColorBlue)
+			width += 1 + len(inst.Tags[cfnStackTag])
+		}
+		if inst.Lifecycle == "spot" {
+			entry += " " + color("spot", qc.ColorPurple)
+			width += 5
+		}
+		if inst.Denied != "" {
+			entry += " " + color("denied", qc.ColorRed)
+			width += 7
+		}
+		if inst.Health == healthImpaired {
+			entry += " " + color(healthImpaired, qc.ColorRed)
+			width += len(healthImpaired) + 1
+		}
+		if opts.Annotate {
+			if issue := connectIssue(inst); issue != "" {
+				entry += " " + color("("+issue+")", qc.ColorRed)
+				width += len(issue) + 3
+			}
+		}
+		entries[i] = color(entry, rowColor)
+		widths[i] = width
+		cellWidth = max(cellWidth, width)
+	}
+
+	columns := menuColumns(opts.Columns, cellWidth, len(entries))
+	if columns <= 1 {
+		for _, entry := range entries {
+			fmt.Println(entry)
+		}
+		return
+	}
+
+	rows := (len(entries) + columns - 1) / columns
+	for r := 0; r < rows; r++ {
+		var line strings.Builder
+		for c := 0; c < columns; c++ {
+			i := c*rows + r
+			if i >= len(entries) {
+				break
+			}
+			if c > 0 {
+				line.WriteString(menuColumnGap)
+			}
+			line.WriteString(entries[i])
+			// Pad all but the last entry on the line to the cell width.
+			if next := (c+1)*rows + r; next < len(entries) && c+1 < columns {
+				line.WriteString(strings.Repeat(" ", cellWidth-widths[i]))
+			}
+		}
+		fmt.Println(line.String())
+	}
+}
+
+// highlightMatch emphasizes the first case-insensitive occurrence of query
+// in name so it is clear why a row matched the filter.
+func highlightMatch(name, query string) string {
+	if query == "" {
+		return name
+	}
+	lowerName := strings.ToLower(name)
+	// Lowercasing some non-ASCII runes changes their length, which would
+	// misalign the indexes below.
+	if len(lowerName) != len(name) {
+		return name
+	}
+	i := strings.Index(lowerName, strings.ToLower(query))
+	if i < 0 {
+		return name
+	}
+	end := i + len(query)
+	return name[:i] + colorBold(name[i:end], qc.ColorYellow) + name[end:]
+}
+
+// menuColumns returns how many menu columns fit the terminal, capped at the
+// requested count. Non-TTY output and narrow terminals get a single column.
+func menuColumns(requested, cellWidth, count int) int {
+	if requested == 1 || count <= 1 {
+		return 1
+	}
+	width := terminalWidth(os.Stdout)
+	if width == 0 {
+		return 1
+	}
+	fit := (width + len(menuColumnGap)) / (cellWidth + len(menuColumnGap))
+	if requested > 0 {
+		fit = min(fit, requested)
+	}
+	return max(1, min(fit, count))
+}
+
+// connectIssue returns a short reason a running instance cannot be connected
+// to based on its SSM status, or "" when it looks connectable. Stopped
+// instances are already explained by their state.
+func connectIssue(inst *InstanceInfo) string {
+	if inst.State != "running" {
+		return ""
+	}
+	switch inst.PingStatus {
+	case "":
+		return "not registered"
+	case "Online":
+		return ""
+	case "ConnectionLost":
+		return "agent offline"
+	default:
+		return "agent " + strings.ToLower(inst.PingStatus)
+	}
+}
+
+// printStacks prints the distinct CloudFormation stacks that own the given
+// instances along with how many instances each stack contains.
+func printStacks(instances []*InstanceInfo) {
+	counts := map[string]int{}
+	for _, inst := range instances {
+		if name, ok := inst.Tags[cfnStackTag]; ok {
+			counts[name]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Println("No instances belong to a CloudFormation stack")
+		return
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+		fmt.Println(color(fmt.Sprintf("%3d. %s (%d instances)", i+1, name, counts[name]), rowColor))
+	}
+}
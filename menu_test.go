@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+func TestHighlightMatch(t *testing.T) {
+	bold := func(s string) string { return colorBold(s, qc.ColorYellow) }
+	tests := []struct {
+		name, query string
+		want        string
+	}{
+		{name: "web-1", query: "", want: "web-1"},
+		{name: "web-1", query: "db", want: "web-1"},
+		{name: "web-1", query: "web", want: bold("web") + "-1"},
+		{name: "Prod-Web", query: "web", want: "Prod-" + bold("Web")},
+		{name: "api-api", query: "api", want: bold("api") + "-api"},
+		// Lowercasing İ changes its length, so it is left unhighlighted.
+		{name: "İstanbul-web", query: "web", want: "İstanbul-web"},
+	}
+	for _, tt := range tests {
+		if got := highlightMatch(tt.name, tt.query); got != tt.want {
+			t.Errorf("highlightMatch(%q, %q) = %q, want %q", tt.name, tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// CloudWatch settings for --show-metrics. Basic monitoring publishes EC2
+// metrics every five minutes, so a shorter window could come back empty.
+const (
+	metricsWindow        = 15 * time.Minute
+	metricsPeriod        = int32(300)
+	metricDataQueryLimit = 500 // Maximum queries per GetMetricData call
+)
+
+// loadCPUMetrics sets CPU on each running instance to its most recent
+// average CPUUtilization. All instances are queried together in as few
+// GetMetricData calls as the per-call query limit allows. Instances without
+// data are left nil.
+func loadCPUMetrics(ctx context.Context, cwClient *cloudwatch.Client, instances []*InstanceInfo) error {
+	running := []*InstanceInfo{}
+	for _, inst := range instances {
+		if inst.State == "running" {
+			running = append(running, inst)
+		}
+	}
+
+	end := time.Now()
+	start := end.Add(-metricsWindow)
+	for offset := 0; offset < len(running); offset += metricDataQueryLimit {
+		batch := running[offset:min(offset+metricDataQueryLimit, len(running))]
+		byQueryID := make(map[string]*InstanceInfo, len(batch))
+		queries := make([]cwtypes.MetricDataQuery, len(batch))
+		for i, inst := range batch {
+			id := fmt.Sprintf("cpu%d", i)
+			byQueryID[id] = inst
+			queries[i] = cwtypes.MetricDataQuery{
+				Id: stringPtr(id),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  stringPtr("AWS/EC2"),
+						MetricName: stringPtr("CPUUtilization"),
+						Dimensions: []cwtypes.Dimension{{Name: stringPtr("InstanceId"), Value: stringPtr(inst.ID)}},
+					},
+					Period: aws.Int32(metricsPeriod),
+					Stat:   stringPtr("Average"),
+				},
+			}
+		}
+
+		paginator := cloudwatch.NewGetMetricDataPaginator(cwClient, &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries,
+			StartTime:         &start,
+			EndTime:           &end,
+			ScanBy:            cwtypes.ScanByTimestampDescending,
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			for _, result := range output.MetricDataResults {
+				inst, ok := byQueryID[derefOr(result.Id, "")]
+				if !ok || len(result.Values) == 0 || inst.CPU != nil {
+					continue
+				}
+				// Newest first, so the first value is the latest.
+				cpu := result.Values[0]
+				inst.CPU = &cpu
+			}
+		}
+	}
+	return nil
+}
+
+// formatCPU renders an instance's CPU for the menu, e.g. "cpu  42%".
+func formatCPU(inst *InstanceInfo) string {
+	if inst.CPU == nil {
+		return "cpu    -"
+	}
+	return fmt.Sprintf("cpu %3.0f%%", *inst.CPU)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// sessionTargetNames maps the instance IDs targeted by sessions to their
+// display names so the session list is recognizable.
+func sessionTargetNames(ctx context.Context, ec2Client *ec2.Client, sessions []ssmtypes.Session, labelTag string) map[string]string {
+	names := map[string]string{}
+	ids := []string{}
+	for _, s := range sessions {
+		if target := derefOr(s.Target, ""); strings.HasPrefix(target, "i-") {
+			ids = append(ids, target)
+		}
+	}
+	if len(ids) == 0 {
+		return names
+	}
+	instances, err := getInstances(ctx, ec2Client, InstanceFilter{
+		Lifecycle:   "all",
+		LabelTag:    labelTag,
+		InstanceIDs: ids,
+	})
+	if err != nil {
+		return names
+	}
+	for _, inst := range instances {
+		names[inst.ID] = inst.DisplayName
+	}
+	return names
+}
+
+// printOwnedSessions prints the numbered list of the caller's sessions.
+func printOwnedSessions(sessions []ssmtypes.Session, names map[string]string) {
+	for i, s := range sessions {
+		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+		target := derefOr(s.Target, "unknown")
+		name := names[target]
+		if name == "" {
+			name = "-"
+		}
+		started := ""
+		if s.StartDate != nil {
+			started = "since " + s.StartDate.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Println(color(fmt.Sprintf("%3d. %s %s %s (%s)", i+1, name, target, started, derefOr(s.SessionId, "")), rowColor))
+	}
+}
+
+// manageOwnedSessions lists the caller's active sessions and lets them
+// resume ("r2") or terminate ("t2") one.
+func manageOwnedSessions(ctx context.Context, ssmClient *ssm.Client, reader *bufio.Reader, sessions []ssmtypes.Session, names map[string]string, region, pluginDir string, opts SessionOptions) error {
+	if len(sessions) == 0 {
+		fmt.Println("You have no active SSM sessions")
+		return nil
+	}
+	printOwnedSessions(sessions, names)
+	if !interactive {
+		return nil
+	}
+
+	fmt.Printf("%s", color("Resume or terminate a session (e.g. r2 or t2). Blank will exit: ", qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		fmt.Println("Exiting")
+		return nil
+	}
+	action, number := strings.ToLower(input[:1]), strings.TrimSpace(input[1:])
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > len(sessions) || (action != "r" && action != "t") {
+		return fmt.Errorf("invalid choice %q: use r or t followed by a session number", input)
+	}
+	session := sessions[n-1]
+	sessionID := derefOr(session.SessionId, "")
+
+	if action == "t" {
+		if _, err := ssmClient.TerminateSession(ctx, &ssm.TerminateSessionInput{SessionId: &sessionID}); err != nil {
+			return fmt.Errorf("failed to terminate session %s: %v", sessionID, wrapAccessDenied(err, "ssm:TerminateSession"))
+		}
+		fmt.Println(color("Terminated session "+sessionID, qc.ColorGreen))
+		return nil
+	}
+	return resumeSession(ctx, ssmClient, session, region, pluginDir, opts)
+}
+
+// resumeSession reconnects to a session with ResumeSession. The aws CLI
+// only returns the stream details for resume-session, so the session manager
+// plugin is invoked directly, the same way start-session does it.
+func resumeSession(ctx context.Context, ssmClient *ssm.Client, session ssmtypes.Session, region, pluginDir string, opts SessionOptions) error {
+	sessionID := derefOr(session.SessionId, "")
+	output, err := ssmClient.ResumeSession(ctx, &ssm.ResumeSessionInput{SessionId: &sessionID})
+	if err != nil {
+		return fmt.Errorf("failed to resume session %s: %v", sessionID, wrapAccessDenied(err, "ssm:ResumeSession"))
+	}
+	response, err := json.Marshal(map[string]string{
+		"SessionId":  derefOr(output.SessionId, sessionID),
+		"StreamUrl":  derefOr(output.StreamUrl, ""),
+		"TokenValue": derefOr(output.TokenValue, ""),
+	})
+	if err != nil {
+		return err
+	}
+	request, err := json.Marshal(map[string]string{"Target": derefOr(session.Target, "")})
+	if err != nil {
+		return err
+	}
+
+	plugin, err := sessionManagerPluginExecutable(pluginDir)
+	if err != nil {
+		return err
+	}
+	endpoint := opts.EndpointURL
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://ssm.%s.amazonaws.com", region)
+	}
+	fmt.Printf("Resuming session %s. This may take a few moments...\n", sessionID)
+	cmd := exec.Command(plugin, string(response), region, "StartSession", os.Getenv("AWS_PROFILE"), string(request), endpoint)
+	cmd.Env = opts.environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Port ranges the SSM agent needs through the subnet's network ACL: HTTPS out
+// to the SSM endpoints and the ephemeral range in for the return traffic,
+// since NACLs are stateless.
+const (
+	ephemeralPortLow  = 1024
+	ephemeralPortHigh = 65535
+)
+
+// portRange is an inclusive range of TCP ports.
+type portRange struct {
+	From, To int32
+}
+
+// checkNetworkACL verifies the subnet's network ACL allows outbound HTTPS and
+// inbound ephemeral return traffic to and from 0.0.0.0/0.
+func checkNetworkACL(ctx context.Context, ec2Client *ec2.Client, instance *types.Instance) DiagnosticResult {
+	if instance.SubnetId == nil {
+		return DiagnosticResult{
+			CheckName: "Network ACL",
+			Status:    "WARN",
+			Message:   "Instance has no subnet ID",
+		}
+	}
+
+	acl, err := subnetNetworkACL(ctx, ec2Client, *instance.SubnetId, derefOr(instance.VpcId, ""))
+	if err != nil {
+		return DiagnosticResult{
+			CheckName: "Network ACL",
+			Status:    "WARN",
+			Message:   fmt.Sprintf("Could not retrieve network ACL: %v", err),
+		}
+	}
+	aclID := derefOr(acl.NetworkAclId, "unknown")
+
+	var problems []string
+	var remediation []string
+	if ok, detail := naclAllows(acl.Entries, true, portRange{443, 443}); !ok {
+		problems = append(problems, "outbound HTTPS (443) "+detail)
+		remediation = append(remediation, fmt.Sprintf(
+			"aws ec2 create-network-acl-entry --network-acl-id %s --egress --rule-number 100 --protocol tcp --port-range From=443,To=443 --cidr-block 0.0.0.0/0 --rule-action allow # pick an unused rule number",
+			aclID,
+		))
+	}
+	if ok, detail := naclAllows(acl.Entries, false, portRange{ephemeralPortLow, ephemeralPortHigh}); !ok {
+		problems = append(problems, fmt.Sprintf("inbound ephemeral ports (%d-%d) %s", ephemeralPortLow, ephemeralPortHigh, detail))
+		remediation = append(remediation, fmt.Sprintf(
+			"aws ec2 create-network-acl-entry --network-acl-id %s --ingress --rule-number 100 --protocol tcp --port-range From=%d,To=%d --cidr-block 0.0.0.0/0 --rule-action allow # pick an unused rule number",
+			aclID, ephemeralPortLow, ephemeralPortHigh,
+		))
+	}
+
+	if len(problems) > 0 {
+		return DiagnosticResult{
+			CheckName:   "Network ACL",
+			Status:      "FAIL",
+			Message:     fmt.Sprintf("Network ACL %s blocks %s", aclID, strings.Join(problems, " and ")),
+			Remediation: remediation,
+		}
+	}
+	return DiagnosticResult{
+		CheckName: "Network ACL",
+		Status:    "PASS",
+		Message:   fmt.Sprintf("Network ACL %s allows outbound HTTPS and inbound ephemeral return traffic", aclID),
+	}
+}
+
+// subnetNetworkACL returns the network ACL associated with the subnet. Subnets
+// without an explicit association use the VPC's default ACL.
+func subnetNetworkACL(ctx context.Context, ec2Client *ec2.Client, subnetID, vpcID string) (*types.NetworkAcl, error) {
+	output, err := ec2Client.DescribeNetworkAcls(ctx, &ec2.DescribeNetworkAclsInput{
+		Filters: []types.Filter{
+			{Name: stringPtr("association.subnet-id"), Values: []string{subnetID}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.NetworkAcls) > 0 {
+		return &output.NetworkAcls[0], nil
+	}
+	if vpcID == "" {
+		return nil, fmt.Errorf("no network ACL associated with subnet %s", subnetID)
+	}
+
+	output, err = ec2Client.DescribeNetworkAcls(ctx, &ec2.DescribeNetworkAclsInput{
+		Filters: []types.Filter{
+			{Name: stringPtr("vpc-id"), Values: []string{vpcID}},
+			{Name: stringPtr("default"), Values: []string{"true"}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.NetworkAcls) == 0 {
+		return nil, fmt.Errorf("no network ACL found for subnet %s", subnetID)
+	}
+	return &output.NetworkAcls[0], nil
+}
+
+// naclAllows evaluates the ACL entries in rule-number order, as AWS does, and
+// reports whether all of want is allowed for TCP traffic to or from
+// 0.0.0.0/0. Rules scoped to narrower CIDRs are skipped since the SSM
+// endpoint addresses are not known. When traffic is blocked, the returned
+// detail names the rule responsible.
+func naclAllows(entries []types.NetworkAclEntry, egress bool, want portRange) (bool, string) {
+	var rules []types.NetworkAclEntry
+	for _, e := range entries {
+		if e.Egress == nil || *e.Egress != egress || derefOr(e.CidrBlock, "") != "0.0.0.0/0" {
+			continue
+		}
+		if protocol := derefOr(e.Protocol, ""); protocol != "-1" && protocol != "6" {
+			continue
+		}
+		rules = append(rules, e)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return derefInt32(rules[i].RuleNumber) < derefInt32(rules[j].RuleNumber)
+	})
+
+	uncovered := []portRange{want}
+	for _, rule := range rules {
+		ruleRange := portRange{0, 65535}
+		if derefOr(rule.Protocol, "") == "6" && rule.PortRange != nil {
+			ruleRange = portRange{derefInt32(rule.PortRange.From), derefInt32(rule.PortRange.To)}
+		}
+		var remaining []portRange
+		for _, r := range uncovered {
+			from, to := max(r.From, ruleRange.From), min(r.To, ruleRange.To)
+			if from > to {
+				remaining = append(remaining, r)
+				continue
+			}
+			if rule.RuleAction == types.RuleActionDeny {
+				return false, fmt.Sprintf("(denied by rule %s)", naclRuleName(rule))
+			}
+			if r.From < from {
+				remaining = append(remaining, portRange{r.From, from - 1})
+			}
+			if to < r.To {
+				remaining = append(remaining, portRange{to + 1, r.To})
+			}
+		}
+		uncovered = remaining
+		if len(uncovered) == 0 {
+			return true, ""
+		}
+	}
+	return false, "(no rule allows it)"
+}
+
+// naclRuleName formats a rule number, using "*" for the default rule.
+func naclRuleName(rule types.NetworkAclEntry) string {
+	n := derefInt32(rule.RuleNumber)
+	if n == 32767 {
+		return "*"
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func derefInt32(v *int32) int32 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// sessionActions are the caller permissions --precheck-perms verifies.
+var sessionActions = []string{"ssm:StartSession"}
+
+// principalForSimulation converts a caller ARN from GetCallerIdentity into
+// the IAM principal ARN SimulatePrincipalPolicy accepts. Assumed-role
+// sessions map to their role; roles with a path cannot be recovered from the
+// session ARN and are reported as unsupported, as is the root user.
+func principalForSimulation(callerArn string) (string, error) {
+	a, err := parseARN(callerArn)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case a.Service == "iam" && (strings.HasPrefix(a.Resource, "user/") || strings.HasPrefix(a.Resource, "role/")):
+		return callerArn, nil
+	case a.Service == "sts" && strings.HasPrefix(a.Resource, "assumed-role/"):
+		parts := strings.Split(a.Resource, "/")
+		if len(parts) != 3 {
+			return "", fmt.Errorf("cannot determine the role for %s", callerArn)
+		}
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", a.Partition, a.AccountID, parts[1]), nil
+	default:
+		return "", fmt.Errorf("permissions cannot be simulated for %s", callerArn)
+	}
+}
+
+// precheckSessionPermissions uses SimulatePrincipalPolicy to check that the
+// caller may start sessions on instanceArn, which may be a wildcard such as
+// every instance in the region. It returns the denied actions.
+func precheckSessionPermissions(ctx context.Context, iamClient *iam.Client, callerArn, instanceArn string) ([]string, error) {
+	principal, err := principalForSimulation(callerArn)
+	if err != nil {
+		return nil, err
+	}
+	output, err := iamClient.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: stringPtr(principal),
+		ActionNames:     sessionActions,
+		ResourceArns:    []string{instanceArn},
+	})
+	if err != nil {
+		return nil, wrapAccessDenied(err, "iam:SimulatePrincipalPolicy")
+	}
+	denied := []string{}
+	for _, result := range output.EvaluationResults {
+		if result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+			denied = append(denied, derefOr(result.EvalActionName, "unknown"))
+		}
+	}
+	return denied, nil
+}
+
+// instanceARNFor returns the ARN of instanceID, or of every instance in the
+// region when instanceID is "*", in the caller's partition.
+func instanceARNFor(callerArn, region, account, instanceID string) string {
+	partition := "aws"
+	if a, err := parseARN(callerArn); err == nil {
+		partition = a.Partition
+	}
+	return fmt.Sprintf("arn:%s:ec2:%s:%s:instance/%s", partition, region, account, instanceID)
+}
+
+// reportSessionPermissions runs precheckSessionPermissions before an instance
+// is picked, so a missing ssm:StartSession is reported up front rather than
+// after, and prints a warning when sessions would be denied or the check
+// could not run.
+func reportSessionPermissions(ctx context.Context, iamClient *iam.Client, callerArn, region, account string) {
+	denied, err := precheckSessionPermissions(ctx, iamClient, callerArn, instanceARNFor(callerArn, region, account, "*"))
+	if err != nil {
+		fmt.Println(color(fmt.Sprintf("⚠️  WARNING: could not check session permissions: %v", err), qc.ColorYellow))
+		return
+	}
+	if len(denied) > 0 {
+		fmt.Println(color(fmt.Sprintf(
+			"⚠️  WARNING: your credentials are not allowed %s in %s - you can list instances but connecting will fail",
+			strings.Join(denied, ", "), region,
+		), qc.ColorRed))
+		return
+	}
+	fmt.Println(color("Session permissions OK", qc.ColorGreen))
+}
+
+// reportConnectPermission follows diagnostics with a note on the caller's
+// own access, which the checks deliberately leave out: they assess whether
+// the instance is ready to accept sessions and need only read access. The
+// note is only printed when the instance looks ready but the caller may not
+// start a session on it. When the permission cannot be simulated, as for
+// read-only auditors without iam:SimulatePrincipalPolicy, nothing is printed.
+func reportConnectPermission(ctx context.Context, iamClient *iam.Client, callerArn, region, account, instanceID string, results []DiagnosticResult) {
+	if _, _, failCount := countResults(results); failCount > 0 {
+		return
+	}
+	denied, err := precheckSessionPermissions(ctx, iamClient, callerArn, instanceARNFor(callerArn, region, account, instanceID))
+	if err != nil || len(denied) == 0 {
+		return
+	}
+	fmt.Printf("\n%s\n", color(fmt.Sprintf(
+		"ℹ️  The instance is ready for SSM, but your credentials are not allowed %s on it. The checks above cover the instance, not your own access.",
+		strings.Join(denied, ", "),
+	), qc.ColorCyan))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// pingCommandDocument runs a single command over a real session without a
+// terminal, so --ping-session exercises the same path as a connection.
+const pingCommandDocument = "AWS-StartNonInteractiveCommand"
+
+// pingMarker is echoed by the ping command; seeing it in the output proves
+// the command ran on the instance. echo works in both sh and PowerShell.
+const pingMarker = "quick_ssm-ping-ok"
+
+// pingWaitDelay bounds how long output is waited for after the ping is
+// killed, in case a child process still holds the output pipe.
+const pingWaitDelay = 2 * time.Second
+
+// pingSession starts a short non-interactive session on instanceID through
+// the aws CLI and session-manager-plugin, runs a harmless echo, and lets the
+// session end. It returns how long the round trip took. Unlike the static
+// diagnostics, a success means a session really works end to end.
+func pingSession(instanceID string, timeout time.Duration, opts SessionOptions) (time.Duration, error) {
+	params, err := interactiveCommandParameters("echo " + pingMarker)
+	if err != nil {
+		return 0, err
+	}
+	opts.Document = pingCommandDocument
+	opts.Parameters = params
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "aws", opts.sessionArgs(instanceID)...)
+	cmd.Env = opts.environ()
+	cmd.WaitDelay = pingWaitDelay
+	killGroupOnCancel(cmd)
+	output, err := cmd.CombinedOutput()
+	elapsed := time.Since(start)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return elapsed, fmt.Errorf("no response within %s", timeout)
+	}
+	if err != nil {
+		return elapsed, fmt.Errorf("%v: %s", err, lastLine(string(output)))
+	}
+	if !strings.Contains(string(output), pingMarker) {
+		return elapsed, fmt.Errorf("session started but the test command produced no output: %s", lastLine(string(output)))
+	}
+	return elapsed, nil
+}
+
+// lastLine returns the last non-empty line of output, which is where the aws
+// CLI puts its error message.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// reportPing runs pingSession and prints the verdict. It reports whether the
+// session worked.
+func reportPing(inst *InstanceInfo, timeout time.Duration, opts SessionOptions) bool {
+	fmt.Printf("Testing a session to %s (%s)...\n", inst.DisplayName, inst.ID)
+	elapsed, err := pingSession(inst.ID, timeout, opts)
+	if err != nil {
+		fmt.Println(color(fmt.Sprintf("❌ Session to %s failed after %s: %v", inst.ID, elapsed.Round(time.Millisecond), err), qc.ColorRed))
+		return false
+	}
+	fmt.Println(color(fmt.Sprintf("✅ Session to %s works (%s)", inst.ID, elapsed.Round(time.Millisecond)), qc.ColorGreen))
+	return true
+}
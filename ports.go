@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// autoPortSearchLimit is how many ports above the requested one --auto-port
+// tries before giving up.
+const autoPortSearchLimit = 100
+
+// localPortAvailable reports whether port can be bound on localhost, which
+// is where session-manager-plugin listens for forwarded connections.
+func localPortAvailable(port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// resolveLocalPort returns port when it is free. Otherwise, with autoPort, it
+// returns the next free port above it, and without it, an error, since the
+// tunnel would otherwise fail quietly once the plugin cannot bind.
+func resolveLocalPort(port int, autoPort bool) (int, error) {
+	if localPortAvailable(port) {
+		return port, nil
+	}
+	if !autoPort {
+		return 0, fmt.Errorf("local port %d is already in use; choose another port or pass --auto-port", port)
+	}
+	for candidate := port + 1; candidate <= min(port+autoPortSearchLimit, 65535); candidate++ {
+		if localPortAvailable(candidate) {
+			return candidate, nil
+		}
+	}
+	return 0, fmt.Errorf("no free local port found between %d and %d", port, min(port+autoPortSearchLimit, 65535))
+}
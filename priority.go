@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// targetPriority ranks the instances an ambiguous --target may auto-select,
+// most preferred first. Each entry is a tag expression; it is set from the
+// config file's targetPriority list.
+var targetPriority [][]TagMatch
+
+// parseTargetPriority parses the config file's targetPriority entries, each
+// a tag expression such as "role=primary" or "role=primary,tier=a".
+func parseTargetPriority(entries []string) ([][]TagMatch, error) {
+	priority := make([][]TagMatch, 0, len(entries))
+	for _, entry := range entries {
+		matches, ok, err := parseTagExpression(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid targetPriority entry %q: expected KEY=VALUE[,KEY=VALUE...]", entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		priority = append(priority, matches)
+	}
+	return priority, nil
+}
+
+// priorityRank returns the index of the first priority entry inst's tags
+// match, or len(priority) when none does.
+func priorityRank(inst *InstanceInfo, priority [][]TagMatch) int {
+	for i, matches := range priority {
+		if matchesAllTags(inst.Tags, matches) {
+			return i
+		}
+	}
+	return len(priority)
+}
+
+// pickByPriority returns the running candidates with the best priority rank
+// and the expression they matched. ok is false when no running candidate
+// matches any priority entry, so the choice is left to the caller.
+func pickByPriority(candidates []*InstanceInfo, priority [][]TagMatch) (best []*InstanceInfo, expression string, ok bool) {
+	bestRank := len(priority)
+	for _, c := range candidates {
+		if c.State != "running" {
+			continue
+		}
+		switch rank := priorityRank(c, priority); {
+		case rank < bestRank:
+			bestRank = rank
+			best = []*InstanceInfo{c}
+		case rank == bestRank && rank < len(priority):
+			best = append(best, c)
+		}
+	}
+	if len(best) == 0 {
+		return nil, "", false
+	}
+	return best, formatTagMatches(priority[bestRank]), true
+}
+
+// formatTagMatches renders matches back as a tag expression.
+func formatTagMatches(matches []TagMatch) string {
+	expression := ""
+	for i, m := range matches {
+		if i > 0 {
+			expression += ","
+		}
+		expression += m.Key + "=" + m.Value
+	}
+	return expression
+}
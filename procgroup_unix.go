@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroupOnCancel starts cmd in its own process group and makes context
+// cancellation kill the whole group, so the session-manager-plugin the aws
+// CLI spawns dies with it instead of holding the output pipe open.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
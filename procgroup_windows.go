@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// killGroupOnCancel is a no-op on Windows, which has no process groups to
+// signal; cmd.WaitDelay still bounds how long a leftover child can block.
+func killGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitCodeInterrupted follows the shell convention of 128 + SIGINT.
+const exitCodeInterrupted = 130
+
+// interactive reports whether quick_ssm may prompt the user. It is false in
+// CI and when stdin/stdout are not terminals, unless --interactive is passed.
+var interactive = true
+
+// errNonInteractive is returned by readInput when a prompt is needed but
+// quick_ssm is running non-interactively.
+var errNonInteractive = errors.New("input required but running non-interactively; pass --target (or --interactive to force prompts)")
+
+// readInput reads a line from reader while trapping SIGINT. Pressing Ctrl-C at
+// a prompt exits cleanly with "Cancelled" and exit code 130 instead of surfacing
+// a read error. Signal handling for SSM sessions is set up separately.
+// Prompts fail with errNonInteractive when interactive is false.
+func readInput(reader *bufio.Reader) (string, error) {
+	if !interactive {
+		return "", errNonInteractive
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT)
+	defer signal.Stop(sigChan)
+
+	type result struct {
+		line string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		line, err := reader.ReadString('\n')
+		done <- result{line, err}
+	}()
+
+	select {
+	case <-sigChan:
+		fmt.Println("\nCancelled")
+		os.Exit(exitCodeInterrupted)
+		return "", nil
+	case res := <-done:
+		return res.line, res.err
+	}
+}
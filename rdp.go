@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Ports used by --rdp: a local port that avoids clashing with a local RDP
+// server, forwarded to the standard RDP port on the instance.
+const (
+	rdpLocalPort  = 13389
+	rdpRemotePort = 3389
+)
+
+// rdpReadyTimeout bounds how long --rdp-launch waits for the tunnel.
+const rdpReadyTimeout = 60 * time.Second
+
+// errNoRDPClient is returned when no supported RDP client is installed.
+var errNoRDPClient = errors.New("no RDP client found (install xfreerdp or remmina)")
+
+// rdpClientCommands returns the candidate RDP client commands for the current
+// OS in order of preference.
+func rdpClientCommands(localPort int) [][]string {
+	address := fmt.Sprintf("localhost:%d", localPort)
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"open", "rdp://full%20address=s:" + address}}
+	case "windows":
+		return [][]string{{"mstsc", "/v:" + address}}
+	default:
+		return [][]string{
+			{"xfreerdp", "/v:" + address},
+			{"remmina", "-c", "rdp://" + address},
+		}
+	}
+}
+
+// launchRDPClient starts the first available RDP client pointed at the local
+// end of the tunnel without waiting for it to exit.
+func launchRDPClient(localPort int) error {
+	for _, args := range rdpClientCommands(localPort) {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		return exec.Command(args[0], args[1:]...).Start()
+	}
+	return errNoRDPClient
+}
+
+// launchRDPWhenReady waits for the port forward to accept connections on
+// localPort, then launches the RDP client. It is meant to run alongside the
+// blocking port-forward session.
+func launchRDPWhenReady(localPort int) {
+	address := fmt.Sprintf("localhost:%d", localPort)
+	deadline := time.Now().Add(rdpReadyTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			if err := launchRDPClient(localPort); err != nil {
+				log.Printf("[WARNING]: could not launch RDP client: %v. Connect to %s manually.", err, address)
+			}
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	log.Printf("[WARNING]: tunnel on %s was not ready after %s; RDP client not launched", address, rdpReadyTimeout)
+}
@@ -0,0 +1,143 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Terminal size recorded when stdout is not a terminal.
+const (
+	defaultCastWidth  = 80
+	defaultCastHeight = 24
+)
+
+// stdinPollInterval is how often copyStdin checks whether it should stop.
+const stdinPollInterval = 100 // milliseconds
+
+// startRecordedSSMSession runs an interactive session like startSSMSession,
+// but inside a PTY quick_ssm owns so everything the session prints can also
+// be written to path as an asciinema .cast file. The local terminal is put
+// in raw mode, so Ctrl-C is passed to the remote shell as a keystroke.
+func startRecordedSSMSession(inst *InstanceInfo, path string, opts SessionOptions) error {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = defaultCastWidth, defaultCastHeight
+	}
+	recorder, err := newCastRecorder(path, width, height, fmt.Sprintf("%s (%s)", inst.DisplayName, inst.ID))
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %v", err)
+	}
+	defer func() {
+		if err := recorder.Close(); err != nil {
+			log.Println("[WARNING]: recording may be incomplete:", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGWINCH)
+	defer signal.Stop(sigChan)
+
+	cmd := exec.Command("aws", opts.sessionArgs(inst.ID)...)
+	cmd.Env = opts.environ()
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(width), Rows: uint16(height)})
+	if err != nil {
+		return fmt.Errorf("failed to start SSM session: %v", err)
+	}
+	defer ptmx.Close()
+
+	if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		defer term.Restore(int(os.Stdin.Fd()), state)
+	}
+	// Stdin is only read when input is waiting, so the copy stops with the
+	// session instead of eating the next keypress at the menu.
+	stopStdin := make(chan struct{})
+	stdinDone := make(chan struct{})
+	go func() {
+		copyStdin(ptmx, stopStdin)
+		close(stdinDone)
+	}()
+	defer func() {
+		close(stopStdin)
+		<-stdinDone
+	}()
+
+	// The PTY merges the session's stdout and stderr.
+	stderr := &stderrTail{}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(os.Stdout, recorder, stderr), ptmx)
+		close(copied)
+	}()
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		<-copied
+		done <- err
+	}()
+
+	deadline := opts.deadline()
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGWINCH {
+				pty.InheritSize(os.Stdout, ptmx)
+				continue
+			}
+			log.Println("Received interrupt signal, terminating SSM session...")
+			cmd.Process.Signal(syscall.SIGTERM)
+			<-done
+			return nil
+		case <-deadline:
+			log.Printf("Maximum session duration of %s reached, terminating SSM session...", opts.MaxDuration)
+			cmd.Process.Signal(syscall.SIGTERM)
+			<-done
+			return nil
+		case err := <-done:
+			if err != nil {
+				return sessionFailure("SSM session ended with error", err, stderr)
+			}
+			return nil
+		}
+	}
+}
+
+// copyStdin copies stdin to dst until stop is closed or stdin fails. Unlike
+// io.Copy, it never blocks in a read, so it can be stopped between
+// keystrokes.
+func copyStdin(dst io.Writer, stop <-chan struct{}) {
+	fd := int(os.Stdin.Fd())
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n, err := unix.Poll(fds, stdinPollInterval)
+		if err == unix.EINTR || (err == nil && n == 0) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		n, err = unix.Read(fd, buf)
+		if n <= 0 || err != nil {
+			return
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "errors"
+
+// startRecordedSSMSession is unavailable on Windows, where quick_ssm cannot
+// run the session inside a PTY of its own.
+func startRecordedSSMSession(inst *InstanceInfo, path string, opts SessionOptions) error {
+	return errors.New("--record is not supported on Windows")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// defaultBootstrapRegion is used for account-level calls such as
+// DescribeRegions when no region has been configured yet.
+const defaultBootstrapRegion = "us-east-1"
+
+// regionCacheTTL controls how long the enabled-region list is reused.
+const regionCacheTTL = 24 * time.Hour
+
+// regionCache is the on-disk format of the cached enabled-region list.
+type regionCache struct {
+	FetchedAt time.Time `json:"fetchedAt"`
+	Regions   []string  `json:"regions"`
+}
+
+// cacheDir returns the directory quick_ssm uses for cached data, creating it
+// if necessary.
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "quick_ssm")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// getEnabledRegions returns the regions enabled for the account, reading from
+// a per-account cache when it is fresh. DescribeRegions only returns regions
+// that are enabled or opted in unless AllRegions is set.
+func getEnabledRegions(ctx context.Context, ec2Client *ec2.Client, accountID string) ([]string, error) {
+	cachePath := ""
+	if dir, err := cacheDir(); err == nil {
+		cachePath = filepath.Join(dir, fmt.Sprintf("regions-%s.json", accountID))
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var cached regionCache
+			if json.Unmarshal(data, &cached) == nil && time.Since(cached.FetchedAt) < regionCacheTTL && len(cached.Regions) > 0 {
+				return cached.Regions, nil
+			}
+		}
+	}
+
+	output, err := ec2Client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+	regions := make([]string, 0, len(output.Regions))
+	for _, r := range output.Regions {
+		if r.RegionName != nil {
+			regions = append(regions, *r.RegionName)
+		}
+	}
+	sort.Strings(regions)
+
+	// Caching is best-effort; failing to write it should not block the user.
+	if cachePath != "" {
+		if data, err := json.Marshal(regionCache{FetchedAt: time.Now(), Regions: regions}); err == nil {
+			_ = os.WriteFile(cachePath, data, 0o600)
+		}
+	}
+	return regions, nil
+}
+
+// regionNotOptedIn is the DescribeRegions opt-in status of a region the
+// account has not enabled.
+const regionNotOptedIn = "not-opted-in"
+
+// checkRegionEnabled verifies that region exists and is enabled for the
+// account before anything else is called there, since calls to a region the
+// account has not opted into fail with confusing authentication errors. The
+// check runs from defaultBootstrapRegion and only applies to the aws
+// partition, the only one with opt-in regions. When the check itself cannot
+// run, e.g. for lack of ec2:DescribeRegions, it is skipped.
+func checkRegionEnabled(ctx context.Context, cfg aws.Config, region string) error {
+	for _, prefix := range []string{"cn-", "us-gov-", "us-iso"} {
+		if strings.HasPrefix(region, prefix) {
+			return nil
+		}
+	}
+	bootstrap := cfg.Copy()
+	bootstrap.Region = defaultBootstrapRegion
+	output, err := ec2.NewFromConfig(bootstrap).DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		AllRegions:  aws.Bool(true),
+		RegionNames: []string{region},
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidParameterValue" {
+			return fmt.Errorf("unknown region %q", region)
+		}
+		return nil
+	}
+	if len(output.Regions) == 0 || derefOr(output.Regions[0].OptInStatus, "") != regionNotOptedIn {
+		return nil
+	}
+	return fmt.Errorf(
+		"region %s is not enabled for this account. Enable it under Account > AWS Regions in the console, or with:\n"+
+			"  aws account enable-region --region-name %s\n"+
+			"Enabling a region can take several minutes",
+		region, region,
+	)
+}
+
+// promptForRegion displays a numbered menu of regions and returns the chosen
+// one. The current region, if any, is highlighted and used for blank input.
+func promptForRegion(reader *bufio.Reader, regions []string, current string) (string, error) {
+	for i, r := range regions {
+		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+		entry := fmt.Sprintf("%3d. %s", i+1, r)
+		if r == current {
+			entry += color(" (current)", qc.ColorGreen)
+		}
+		fmt.Println(color(entry, rowColor))
+	}
+	prompt := "Select region: "
+	if current != "" {
+		prompt = fmt.Sprintf("Select region. Blank uses %s: ", current)
+	}
+	fmt.Printf("%s", color(prompt, qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return "", err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" && current != "" {
+		return current, nil
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > len(regions) {
+		return "", fmt.Errorf("invalid region selection: %q", input)
+	}
+	return regions[choice-1], nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroups"
+	rgtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroups/types"
+	"github.com/aws/smithy-go"
+)
+
+// ec2InstanceResourceType is the resource type Resource Groups uses for EC2
+// instances.
+const ec2InstanceResourceType = "AWS::EC2::Instance"
+
+// resourceGroupInstanceIDs lists the IDs of the EC2 instances that belong to
+// the named resource group.
+func resourceGroupInstanceIDs(ctx context.Context, client *resourcegroups.Client, group string) ([]string, error) {
+	paginator := resourcegroups.NewListGroupResourcesPaginator(client, &resourcegroups.ListGroupResourcesInput{
+		Group: &group,
+		Filters: []rgtypes.ResourceFilter{
+			{
+				Name:   rgtypes.ResourceFilterNameResourceType,
+				Values: []string{ec2InstanceResourceType},
+			},
+		},
+	})
+
+	var ids []string
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) {
+				switch apiErr.ErrorCode() {
+				case "NotFoundException":
+					return nil, fmt.Errorf("resource group %q not found", group)
+				case "BadRequestException":
+					return nil, fmt.Errorf("resource group %q does not contain EC2 instances: %s", group, apiErr.ErrorMessage())
+				}
+			}
+			return nil, wrapAccessDenied(err, "resource-groups:ListGroupResources")
+		}
+		for _, item := range output.Resources {
+			if item.Identifier == nil || item.Identifier.ResourceArn == nil {
+				continue
+			}
+			id, err := instanceIDFromARN(*item.Identifier.ResourceArn)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("resource group %q does not contain any EC2 instances", group)
+	}
+	return ids, nil
+}
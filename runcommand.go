@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// sendCommandBatchSize is the maximum number of instance IDs SendCommand
+// accepts in a single call.
+const sendCommandBatchSize = 50
+
+// commandPollInterval is how often command invocations are polled for status.
+const commandPollInterval = 2 * time.Second
+
+// commandOutputLimit is how many characters of output GetCommandInvocation
+// returns inline; anything beyond it is only available from S3.
+const commandOutputLimit = 24000
+
+// commandOutputKeyPrefix is the S3 key prefix for --output-s3-bucket output.
+const commandOutputKeyPrefix = "quick_ssm"
+
+// followLogGroup is the CloudWatch Logs group --follow sends output to.
+// GetCommandInvocation only returns output once the command finishes, so
+// live output has to be read from CloudWatch Logs instead.
+const followLogGroup = "/quick_ssm/run-command"
+
+// documentPluginNames maps the Run Command documents to the name of the
+// plugin step that runs the command, which names its log streams.
+var documentPluginNames = map[string]string{
+	runShellScriptDocument:      "aws-runShellScript",
+	runPowerShellScriptDocument: "aws-runPowerShellScript",
+}
+
+// RunOptions controls how run-command output is collected.
+type RunOptions struct {
+	Follow         bool   // Print output while the command runs rather than at the end
+	OutputS3Bucket string // Also write the full output to this S3 bucket
+}
+
+// Run Command documents for each instance platform.
+const (
+	runShellScriptDocument      = "AWS-RunShellScript"
+	runPowerShellScriptDocument = "AWS-RunPowerShellScript"
+)
+
+// CommandSpec is a command to run, per instance platform. In JSON a bare
+// string is accepted as a shell-only command.
+type CommandSpec struct {
+	Shell      string `json:"shell,omitempty"`      // Run on Linux instances with AWS-RunShellScript
+	PowerShell string `json:"powershell,omitempty"` // Run on Windows instances with AWS-RunPowerShellScript
+}
+
+// UnmarshalJSON accepts either a string or a {"shell", "powershell"} object.
+func (c *CommandSpec) UnmarshalJSON(data []byte) error {
+	var shell string
+	if err := json.Unmarshal(data, &shell); err == nil {
+		*c = CommandSpec{Shell: shell}
+		return nil
+	}
+	type plain CommandSpec
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// forInstance returns the document and command to run on inst, or an error
+// when the spec has no command for the instance's platform.
+func (c CommandSpec) forInstance(inst *InstanceInfo) (document, command string, err error) {
+	if isWindows(inst) {
+		if c.PowerShell == "" {
+			return "", "", fmt.Errorf("no PowerShell command for Windows instance %s (%s)", inst.DisplayName, inst.ID)
+		}
+		return runPowerShellScriptDocument, c.PowerShell, nil
+	}
+	if c.Shell == "" {
+		return "", "", fmt.Errorf("no shell command for instance %s (%s)", inst.DisplayName, inst.ID)
+	}
+	return runShellScriptDocument, c.Shell, nil
+}
+
+// isWindows reports whether inst runs Windows.
+func isWindows(inst *InstanceInfo) bool {
+	return strings.EqualFold(inst.Platform, "windows")
+}
+
+// CommandResult holds the outcome of a command on a single instance.
+type CommandResult struct {
+	Instance *InstanceInfo
+	Status   string // The final invocation status (Success, Failed, TimedOut, ...)
+	Stdout   string
+	Stderr   string
+	Err      error
+
+	Truncated bool   // The inline output hit commandOutputLimit
+	OutputURL string // The S3 URL of the full stdout, when --output-s3-bucket is set
+}
+
+// parseSelection parses menu selections such as "3", "1,3,5-7", or "all"
+// into zero-based indexes, preserving order and dropping duplicates.
+func parseSelection(input string, count int) ([]int, error) {
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, "all") {
+		indexes := make([]int, count)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	indexes := []int{}
+	seen := map[int]bool{}
+	add := func(n int) error {
+		if n < 1 || n > count {
+			return fmt.Errorf("selection %d is out of range (1-%d)", n, count)
+		}
+		if !seen[n-1] {
+			seen[n-1] = true
+			indexes = append(indexes, n-1)
+		}
+		return nil
+	}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			start, err1 := strconv.Atoi(strings.TrimSpace(lo))
+			end, err2 := strconv.Atoi(strings.TrimSpace(hi))
+			if err1 != nil || err2 != nil || start > end {
+				return nil, fmt.Errorf("invalid range: %s", part)
+			}
+			for n := start; n <= end; n++ {
+				if err := add(n); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection: %s", part)
+		}
+		if err := add(n); err != nil {
+			return nil, err
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, errors.New("no instances selected")
+	}
+	return indexes, nil
+}
+
+// promptForInstances asks the user to pick one or more instances from the
+// menu. It returns nil without an error when the user chooses to exit.
+func promptForInstances(reader *bufio.Reader, instances []*InstanceInfo) ([]*InstanceInfo, error) {
+	fmt.Printf("%s", color("Select instances (e.g. 3, 1,4, 2-5, or all). Blank will exit: ", qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input) == "" {
+		fmt.Println("Exiting")
+		return nil, nil
+	}
+	indexes, err := parseSelection(input, len(instances))
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]*InstanceInfo, len(indexes))
+	for i, idx := range indexes {
+		selected[i] = instances[idx]
+	}
+	return selected, nil
+}
+
+// confirmRunCommand prints the resolved targets and the exact command, then
+// asks for confirmation. Running a command on the wrong set of instances is
+// dangerous, so the preview is always shown; skipConfirm (--yes) only skips
+// the question.
+func confirmRunCommand(reader *bufio.Reader, targets []*InstanceInfo, spec CommandSpec, skipConfirm bool) (bool, error) {
+	fmt.Printf("\n%s\n", colorBold(fmt.Sprintf("About to run on %d instance(s):", len(targets)), qc.ColorYellow))
+	hasWindows, hasLinux := false, false
+	for _, inst := range targets {
+		fmt.Printf("  - %s %s [%s]\n", inst.DisplayName, color(inst.ID, qc.ColorWhite), color(inst.State, colorInstState(inst.State)))
+		if isWindows(inst) {
+			hasWindows = true
+		} else {
+			hasLinux = true
+		}
+	}
+	if hasLinux && hasWindows && spec.Shell != spec.PowerShell {
+		fmt.Printf("%s %s\n", colorBold("Command (shell):", qc.ColorYellow), spec.Shell)
+		fmt.Printf("%s %s\n", colorBold("Command (PowerShell):", qc.ColorYellow), spec.PowerShell)
+	} else if hasWindows {
+		fmt.Printf("%s %s\n", colorBold("Command:", qc.ColorYellow), spec.PowerShell)
+	} else {
+		fmt.Printf("%s %s\n", colorBold("Command:", qc.ColorYellow), spec.Shell)
+	}
+	if skipConfirm {
+		return true, nil
+	}
+
+	fmt.Printf("%s", color(fmt.Sprintf("Run this command on %d instance(s)? (y/N): ", len(targets)), qc.ColorYellow))
+	input, err := readInput(reader)
+	if err != nil {
+		return false, err
+	}
+	input = strings.TrimSpace(input)
+	return input == "y" || input == "Y" || input == "yes", nil
+}
+
+// validateCommandSpec checks that spec has a command for every target's
+// platform, so nothing is sent when some targets cannot run it.
+func validateCommandSpec(spec CommandSpec, targets []*InstanceInfo) error {
+	for _, inst := range targets {
+		if _, _, err := spec.forInstance(inst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCommand sends the command to the targets with SendCommand, using
+// AWS-RunShellScript for Linux and AWS-RunPowerShellScript for Windows
+// instances, then waits for every invocation to finish. The instances run
+// the command in parallel. With opts.Follow, output is also sent to
+// followLogGroup and tailed from there with logsClient as it arrives.
+func runCommand(ctx context.Context, ssmClient *ssm.Client, logsClient *cloudwatchlogs.Client, targets []*InstanceInfo, spec CommandSpec, opts RunOptions) ([]CommandResult, error) {
+	if err := validateCommandSpec(spec, targets); err != nil {
+		return nil, err
+	}
+
+	// Group target indexes by document so each SendCommand call runs a single
+	// document; results keep the order of targets.
+	type commandGroup struct {
+		document, command string
+		indexes           []int
+	}
+	var groups []*commandGroup
+	byDocument := map[string]*commandGroup{}
+	for i, inst := range targets {
+		document, command, _ := spec.forInstance(inst)
+		group, ok := byDocument[document]
+		if !ok {
+			group = &commandGroup{document: document, command: command}
+			byDocument[document] = group
+			groups = append(groups, group)
+		}
+		group.indexes = append(group.indexes, i)
+	}
+
+	var follower *outputFollower
+	if opts.Follow {
+		follower = &outputFollower{prefix: len(targets) > 1, logs: logsClient}
+	}
+
+	results := make([]CommandResult, len(targets))
+	// Batches already sent keep running if a later one fails, so their
+	// command IDs are reported rather than dropped.
+	dispatched := []string{}
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		for start := 0; start < len(group.indexes); start += sendCommandBatchSize {
+			batch := group.indexes[start:min(start+sendCommandBatchSize, len(group.indexes))]
+			ids := make([]string, 0, len(batch))
+			for _, i := range batch {
+				ids = append(ids, targets[i].ID)
+			}
+
+			input := &ssm.SendCommandInput{
+				DocumentName: stringPtr(group.document),
+				InstanceIds:  ids,
+				Parameters:   map[string][]string{"commands": {group.command}},
+				Comment:      stringPtr("quick_ssm run-command"),
+			}
+			if opts.Follow {
+				input.CloudWatchOutputConfig = &ssmtypes.CloudWatchOutputConfig{
+					CloudWatchOutputEnabled: true,
+					CloudWatchLogGroupName:  stringPtr(followLogGroup),
+				}
+			}
+			if opts.OutputS3Bucket != "" {
+				input.OutputS3BucketName = stringPtr(opts.OutputS3Bucket)
+				input.OutputS3KeyPrefix = stringPtr(commandOutputKeyPrefix)
+			}
+			output, err := ssmClient.SendCommand(ctx, input)
+			if err != nil {
+				if len(dispatched) == 0 {
+					return nil, fmt.Errorf("failed to send command: %v", err)
+				}
+				return nil, fmt.Errorf(
+					"failed to send command to %d instance(s): %v. Already sent and still running: %s",
+					len(ids), err, strings.Join(dispatched, ", "),
+				)
+			}
+
+			commandID := *output.Command.CommandId
+			dispatched = append(dispatched, fmt.Sprintf("%s (%d instance(s))", commandID, len(ids)))
+			for _, i := range batch {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = waitForInvocation(ctx, ssmClient, commandID, targets[i], group.document, follower)
+				}(i)
+			}
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// waitForInvocation polls GetCommandInvocation until the command reaches a
+// terminal status on the instance. With a follower, output is tailed from
+// CloudWatch Logs and printed as it appears between polls.
+func waitForInvocation(ctx context.Context, ssmClient *ssm.Client, commandID string, inst *InstanceInfo, document string, follower *outputFollower) CommandResult {
+	result := CommandResult{Instance: inst}
+	var stdoutTail, stderrTail *logTail
+	if follower != nil {
+		streamPrefix := fmt.Sprintf("%s/%s/%s/", commandID, inst.ID, documentPluginNames[document])
+		stdoutTail = &logTail{stream: streamPrefix + "stdout"}
+		stderrTail = &logTail{stream: streamPrefix + "stderr"}
+	}
+	for {
+		output, err := ssmClient.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
+			CommandId:  stringPtr(commandID),
+			InstanceId: stringPtr(inst.ID),
+		})
+		if err != nil {
+			// Invocations are eventually consistent and may not exist yet
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvocationDoesNotExist" {
+				result.Err = err
+				return result
+			}
+		} else {
+			final := isTerminalInvocationStatus(output.Status)
+			stdout := derefOr(output.StandardOutputContent, "")
+			stderr := derefOr(output.StandardErrorContent, "")
+			if follower != nil {
+				if final {
+					// The agent uploads its last output shortly after
+					// the invocation finishes.
+					time.Sleep(commandPollInterval)
+				}
+				follower.follow(ctx, inst, stdoutTail, final, false)
+				follower.follow(ctx, inst, stderrTail, final, true)
+				// Without any log output, e.g. when the instance profile
+				// cannot write to CloudWatch Logs, fall back to the inline
+				// output once the command is done.
+				if final && stdoutTail.content == "" && stderrTail.content == "" {
+					follower.emit(inst, stdout, 0, true, false)
+					follower.emit(inst, stderr, 0, true, true)
+				}
+			}
+			if final {
+				result.Status = string(output.Status)
+				result.Stdout = stdout
+				result.Stderr = stderr
+				result.Truncated = len(stdout) >= commandOutputLimit || len(stderr) >= commandOutputLimit
+				result.OutputURL = derefOr(output.StandardOutputUrl, "")
+				return result
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		case <-time.After(commandPollInterval):
+		}
+	}
+}
+
+// outputFollower prints command output incrementally for --follow. Output
+// from several instances is interleaved line by line, prefixed with the
+// instance name.
+type outputFollower struct {
+	mu     sync.Mutex
+	prefix bool
+	logs   *cloudwatchlogs.Client
+}
+
+// logTail is the part of one invocation log stream read so far.
+type logTail struct {
+	stream  string
+	token   *string // Where the next GetLogEvents call continues
+	content string  // Everything read from the stream
+	seen    int     // How much of content has been printed
+}
+
+// follow reads any new events from tail's log stream and prints them. A
+// stream that does not exist yet is not an error; the agent creates it with
+// the first output.
+func (f *outputFollower) follow(ctx context.Context, inst *InstanceInfo, tail *logTail, final, isErr bool) {
+	for {
+		output, err := f.logs.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  stringPtr(followLogGroup),
+			LogStreamName: stringPtr(tail.stream),
+			StartFromHead: aws.Bool(true),
+			NextToken:     tail.token,
+		})
+		if err != nil {
+			break
+		}
+		for _, event := range output.Events {
+			message := derefOr(event.Message, "")
+			if !strings.HasSuffix(message, "\n") {
+				message += "\n"
+			}
+			tail.content += message
+		}
+		// The forward token stays the same once the end is reached.
+		done := output.NextForwardToken == nil || (tail.token != nil && *output.NextForwardToken == *tail.token)
+		tail.token = output.NextForwardToken
+		if done || len(output.Events) == 0 {
+			break
+		}
+	}
+	tail.seen = f.emit(inst, tail.content, tail.seen, final, isErr)
+}
+
+// emit prints the part of content past seen and returns the new offset. Until
+// the invocation is final, a trailing partial line is held back so lines are
+// never split across polls.
+func (f *outputFollower) emit(inst *InstanceInfo, content string, seen int, final, isErr bool) int {
+	if len(content) <= seen {
+		return seen
+	}
+	chunk := content[seen:]
+	if !final {
+		end := strings.LastIndex(chunk, "\n")
+		if end < 0 {
+			return seen
+		}
+		chunk = chunk[:end+1]
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(chunk, "\n"), "\n") {
+		if isErr {
+			line = color(line, qc.ColorRed)
+		}
+		if f.prefix {
+			line = color("["+inst.DisplayName+"] ", qc.ColorCyan) + line
+		}
+		fmt.Println(line)
+	}
+	return seen + len(chunk)
+}
+
+// isTerminalInvocationStatus reports whether status is final.
+func isTerminalInvocationStatus(status ssmtypes.CommandInvocationStatus) bool {
+	switch status {
+	case ssmtypes.CommandInvocationStatusPending,
+		ssmtypes.CommandInvocationStatusInProgress,
+		ssmtypes.CommandInvocationStatusDelayed,
+		ssmtypes.CommandInvocationStatusCancelling:
+		return false
+	default:
+		return true
+	}
+}
+
+// displayCommandResults prints each instance's status and output. With
+// followed, the output was already printed and only statuses are shown. It
+// returns true when the command succeeded everywhere.
+func displayCommandResults(results []CommandResult, followed bool) bool {
+	allSucceeded := true
+	for _, r := range results {
+		status := r.Status
+		statusColor := qc.ColorGreen
+		if r.Err != nil {
+			status = "Error: " + r.Err.Error()
+		}
+		if r.Err != nil || r.Status != string(ssmtypes.CommandInvocationStatusSuccess) {
+			statusColor = qc.ColorRed
+			allSucceeded = false
+		}
+
+		fmt.Printf("\n%s %s [%s]\n", colorBold(r.Instance.DisplayName, qc.ColorCyan), color(r.Instance.ID, qc.ColorWhite), color(status, statusColor))
+		if !followed {
+			if out := strings.TrimRight(r.Stdout, "\n"); out != "" {
+				fmt.Println(out)
+			}
+			if errOut := strings.TrimRight(r.Stderr, "\n"); errOut != "" {
+				fmt.Println(color(errOut, qc.ColorRed))
+			}
+		}
+		if r.Truncated {
+			if r.OutputURL != "" {
+				fmt.Println(color("Output truncated; full output: "+r.OutputURL, qc.ColorYellow))
+			} else {
+				fmt.Println(color(fmt.Sprintf(
+					"Output truncated at %d characters; use --output-s3-bucket to capture all of it", commandOutputLimit,
+				), qc.ColorYellow))
+			}
+		}
+	}
+	return allSucceeded
+}
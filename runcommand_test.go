@@ -0,0 +1,40 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		count   int
+		want    []int
+		wantErr bool
+	}{
+		{input: "3", count: 5, want: []int{2}},
+		{input: "1,3,5-7", count: 7, want: []int{0, 2, 4, 5, 6}},
+		{input: " 2 , 1 ", count: 3, want: []int{1, 0}},
+		{input: "1,1,1-2", count: 3, want: []int{0, 1}},
+		{input: "all", count: 3, want: []int{0, 1, 2}},
+		{input: "ALL", count: 2, want: []int{0, 1}},
+		{input: "1,,2", count: 2, want: []int{0, 1}},
+		{input: "0", count: 3, wantErr: true},
+		{input: "4", count: 3, wantErr: true},
+		{input: "2-4", count: 3, wantErr: true},
+		{input: "3-1", count: 3, wantErr: true},
+		{input: "a-b", count: 3, wantErr: true},
+		{input: "x", count: 3, wantErr: true},
+		{input: ",", count: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelection(tt.input, tt.count)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelection(%q, %d) error = %v, wantErr %v", tt.input, tt.count, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseSelection(%q, %d) = %v, want %v", tt.input, tt.count, got, tt.want)
+		}
+	}
+}
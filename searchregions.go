@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// RegionMatch is a region where --search-all-regions found the target.
+type RegionMatch struct {
+	Region    string
+	Instances []*InstanceInfo
+}
+
+// targetMatches returns the instances target resolves to: one on an exact
+// match, several when it is ambiguous, none when nothing matches.
+func targetMatches(target string, instances []*InstanceInfo) []*InstanceInfo {
+	inst, err := resolveTarget(target, instances)
+	var ambiguous *AmbiguousTargetError
+	if errors.As(err, &ambiguous) {
+		return ambiguous.Matches
+	}
+	if err != nil {
+		return nil
+	}
+	return []*InstanceInfo{inst}
+}
+
+// searchTargetRegions looks for target in every enabled region except
+// cfg.Region, querying the regions in parallel. Regions that cannot be
+// queried are skipped with a warning. Matches are returned sorted by region.
+// Progress goes to stderr so it never mixes with machine-readable output.
+func searchTargetRegions(ctx context.Context, cfg aws.Config, accountID string, filter InstanceFilter, target string) ([]RegionMatch, error) {
+	regions, err := getEnabledRegions(ctx, ec2.NewFromConfig(cfg), accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list enabled regions: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "%q not found in %s; searching %d other regions...\n", target, cfg.Region, len(regions)-1)
+
+	var (
+		mu      sync.Mutex
+		matches []RegionMatch
+		wg      sync.WaitGroup
+	)
+	for _, region := range regions {
+		if region == cfg.Region {
+			continue
+		}
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			regionCfg := cfg.Copy()
+			regionCfg.Region = region
+			candidates, err := getTargetCandidates(ctx, ec2.NewFromConfig(regionCfg), filter, target)
+			if err != nil {
+				log.Printf("[WARNING]: could not search %s: %v", region, err)
+				return
+			}
+			if found := targetMatches(target, candidates); len(found) > 0 {
+				mu.Lock()
+				matches = append(matches, RegionMatch{Region: region, Instances: found})
+				mu.Unlock()
+			}
+		}(region)
+	}
+	wg.Wait()
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Region < matches[j].Region })
+	return matches, nil
+}
+
+// reportRegionMatches prints where the target was found, to stderr.
+func reportRegionMatches(target string, matches []RegionMatch) {
+	if len(matches) == 0 {
+		fmt.Fprintln(os.Stderr, color(fmt.Sprintf("%q was not found in any enabled region", target), qc.ColorYellow))
+		return
+	}
+	for _, m := range matches {
+		ids := make([]string, len(m.Instances))
+		for i, inst := range m.Instances {
+			ids[i] = inst.ID
+		}
+		fmt.Fprintln(os.Stderr, color(fmt.Sprintf("Found %q in %s: %s", target, m.Region, strings.Join(ids, ", ")), qc.ColorCyan))
+	}
+}
+
+// promptForMatchRegion asks whether to connect using the region the target
+// was found in, or which one when it was found in several. It returns "" if
+// the user declines.
+func promptForMatchRegion(reader *bufio.Reader, matches []RegionMatch) (string, error) {
+	if len(matches) == 1 {
+		fmt.Printf("%s", color(fmt.Sprintf("Connect using %s? (Y/n): ", matches[0].Region), qc.ColorYellow))
+		input, err := readInput(reader)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "", "y", "yes":
+			return matches[0].Region, nil
+		}
+		return "", nil
+	}
+	regions := make([]string, len(matches))
+	for i, m := range matches {
+		regions[i] = m.Region
+	}
+	return promptForRegion(reader, regions, "")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// getActiveSessions returns the active SSM sessions targeting the instance.
+func getActiveSessions(ctx context.Context, ssmClient *ssm.Client, instanceID string) ([]ssmtypes.Session, error) {
+	return describeActiveSessions(ctx, ssmClient, ssmtypes.SessionFilter{
+		Key:   ssmtypes.SessionFilterKeyTargetId,
+		Value: stringPtr(instanceID),
+	})
+}
+
+// getOwnedSessions returns the active SSM sessions started by ownerArn.
+func getOwnedSessions(ctx context.Context, ssmClient *ssm.Client, ownerArn string) ([]ssmtypes.Session, error) {
+	return describeActiveSessions(ctx, ssmClient, ssmtypes.SessionFilter{
+		Key:   ssmtypes.SessionFilterKeyOwner,
+		Value: stringPtr(ownerArn),
+	})
+}
+
+// describeActiveSessions lists the active SSM sessions matching filters.
+func describeActiveSessions(ctx context.Context, ssmClient *ssm.Client, filters ...ssmtypes.SessionFilter) ([]ssmtypes.Session, error) {
+	sessions := []ssmtypes.Session{}
+	paginator := ssm.NewDescribeSessionsPaginator(ssmClient, &ssm.DescribeSessionsInput{
+		State:   ssmtypes.SessionStateActive,
+		Filters: filters,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, output.Sessions...)
+	}
+	return sessions, nil
+}
+
+// printActiveSessions warns when other sessions are already open on the
+// instance so that teammates mid-debug are not surprised.
+func printActiveSessions(ctx context.Context, ssmClient *ssm.Client, instanceID string) {
+	sessions, err := getActiveSessions(ctx, ssmClient, instanceID)
+	if err != nil {
+		fmt.Println(color(fmt.Sprintf("Could not check for active sessions: %v", err), qc.ColorYellow))
+		return
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	owners := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		owner := sessionOwnerName(derefOr(session.Owner, "unknown"))
+		if session.StartDate != nil {
+			owner = fmt.Sprintf("%s (since %s)", owner, session.StartDate.Local().Format("15:04"))
+		}
+		owners = append(owners, owner)
+	}
+	plural := "s"
+	if len(sessions) == 1 {
+		plural = ""
+	}
+	fmt.Println(color(fmt.Sprintf(
+		"👥 %d active session%s on this instance: %s",
+		len(sessions), plural, strings.Join(owners, ", "),
+	), qc.ColorYellow))
+}
+
+// sessionOwnerName shortens an owner ARN such as
+// arn:aws:sts::123456789012:assumed-role/Admin/alice to its final segment.
+func sessionOwnerName(owner string) string {
+	parts := strings.Split(owner, "/")
+	return parts[len(parts)-1]
+}
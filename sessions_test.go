@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestSessionOwnerName(t *testing.T) {
+	tests := []struct {
+		owner, want string
+	}{
+		{owner: "arn:aws:sts::123456789012:assumed-role/Admin/alice", want: "alice"},
+		{owner: "arn:aws:iam::123456789012:user/bob", want: "bob"},
+		{owner: "arn:aws:iam::123456789012:root", want: "arn:aws:iam::123456789012:root"},
+		{owner: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := sessionOwnerName(tt.owner); got != tt.want {
+			t.Errorf("sessionOwnerName(%q) = %q, want %q", tt.owner, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// singleKeyLimit is the largest menu whose entries can be picked with a
+// single keypress.
+const singleKeyLimit = 9
+
+// Control characters read in raw mode.
+const (
+	keyCtrlC = 3
+	keyEsc   = 27
+)
+
+// useSingleKey reports whether a menu of count entries is picked with a
+// single keypress rather than a typed number and Enter. Ranges need typing,
+// and raw mode needs a terminal on stdin.
+func useSingleKey(count int, allowRange bool) bool {
+	return count <= singleKeyLimit && !allowRange && interactive && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// readSelectionKey reads a menu selection from a single keypress in raw
+// mode. A digit is returned immediately; Enter and Esc return "" to exit.
+// Any other key starts a typed line, which is echoed and read up to Enter,
+// so "?3" and "sort state" still work. Ctrl-C exits like readInput does.
+func readSelectionKey(reader *bufio.Reader) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return readInput(reader)
+	}
+	key, err := reader.ReadByte()
+	term.Restore(fd, state)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case key == keyCtrlC:
+		fmt.Println("\nCancelled")
+		os.Exit(exitCodeInterrupted)
+	case key == '\r' || key == '\n' || key == keyEsc:
+		fmt.Println()
+		return "", nil
+	case key >= '1' && key <= '9':
+		fmt.Println(string(key))
+		return string(key), nil
+	}
+	fmt.Print(string(key))
+	rest, err := readInput(reader)
+	return string(key) + rest, err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Supported values for the --sort flag.
+const (
+	sortByName       = "name"        // Alphabetical by name, then ID
+	sortByOnline     = "online"      // SSM online first, then running, then name
+	sortByLastActive = "last-active" // Most recent SSM ping first, offline last
+	sortByState      = "state"       // Running first, then pending, stopping, stopped, and the rest
+	sortByLaunch     = "launch"      // Most recently launched first
+)
+
+// sortModes lists the accepted --sort values in the order they are documented.
+var sortModes = []string{sortByName, sortByOnline, sortByLastActive, sortByState, sortByLaunch}
+
+// isValidSortMode reports whether mode is an accepted --sort value.
+func isValidSortMode(mode string) bool {
+	for _, m := range sortModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sortNeedsSSMStatus reports whether mode depends on SSM agent status.
+func sortNeedsSSMStatus(mode string) bool {
+	return mode == sortByOnline || mode == sortByLastActive
+}
+
+// sortInstances orders instances in place according to mode. Name and then
+// instance ID are always used as the final tiebreakers.
+func sortInstances(instances []*InstanceInfo, mode string) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		switch mode {
+		case sortByOnline:
+			if ra, rb := onlineRank(a), onlineRank(b); ra != rb {
+				return ra < rb
+			}
+		case sortByLastActive:
+			onlineA := a.PingStatus == string(ssmtypes.PingStatusOnline)
+			onlineB := b.PingStatus == string(ssmtypes.PingStatusOnline)
+			if onlineA != onlineB {
+				return onlineA
+			}
+			if !a.LastPing.Equal(b.LastPing) {
+				return a.LastPing.After(b.LastPing)
+			}
+		case sortByState:
+			if ra, rb := stateRank(a.State), stateRank(b.State); ra != rb {
+				return ra < rb
+			}
+		case sortByLaunch:
+			if !a.LaunchTime.Equal(b.LaunchTime) {
+				return a.LaunchTime.After(b.LaunchTime)
+			}
+		}
+		if a.Name == b.Name {
+			return a.ID < b.ID
+		}
+		return a.Name < b.Name
+	})
+}
+
+// onlineRank ranks instances so that running+online instances come first,
+// then running+offline, then stopped, then everything else.
+func onlineRank(inst *InstanceInfo) int {
+	switch {
+	case inst.State == "running" && inst.PingStatus == string(ssmtypes.PingStatusOnline):
+		return 0
+	case inst.State == "running":
+		return 1
+	case inst.State == "stopped":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// stateRank orders instance states from most to least connectable.
+func stateRank(state string) int {
+	switch state {
+	case "running":
+		return 0
+	case "pending":
+		return 1
+	case "stopping":
+		return 2
+	case "stopped":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// SortRequest is returned by promptForInstance when the user enters a
+// "sort MODE" command instead of a selection, asking for the menu to be
+// re-sorted and shown again.
+type SortRequest struct {
+	Mode string
+}
+
+func (r *SortRequest) Error() string {
+	return fmt.Sprintf("sort by %s requested", r.Mode)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSortInstances(t *testing.T) {
+	now := time.Now()
+	instances := func() []*InstanceInfo {
+		return []*InstanceInfo{
+			{ID: "i-4", Name: "web", State: "stopped", LaunchTime: now.Add(-4 * time.Hour)},
+			{ID: "i-2", Name: "api", State: "running", PingStatus: "ConnectionLost", LastPing: now.Add(-time.Hour), LaunchTime: now.Add(-2 * time.Hour)},
+			{ID: "i-3", Name: "web", State: "running", PingStatus: "Online", LastPing: now, LaunchTime: now.Add(-3 * time.Hour)},
+			{ID: "i-1", Name: "db", State: "pending", LaunchTime: now},
+			{ID: "i-5", Name: "cache", State: "terminated", LaunchTime: now.Add(-time.Minute)},
+		}
+	}
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{mode: sortByName, want: []string{"i-2", "i-5", "i-1", "i-3", "i-4"}},
+		{mode: sortByOnline, want: []string{"i-3", "i-2", "i-4", "i-5", "i-1"}},
+		{mode: sortByLastActive, want: []string{"i-3", "i-2", "i-5", "i-1", "i-4"}},
+		{mode: sortByState, want: []string{"i-2", "i-3", "i-1", "i-4", "i-5"}},
+		{mode: sortByLaunch, want: []string{"i-1", "i-5", "i-2", "i-3", "i-4"}},
+	}
+	for _, tt := range tests {
+		list := instances()
+		sortInstances(list, tt.mode)
+		got := make([]string, len(list))
+		for i, inst := range list {
+			got[i] = inst.ID
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortInstances(%s) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
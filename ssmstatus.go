@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// loadSSMStatus populates the SSM agent fields of each instance using a single
+// paginated DescribeInstanceInformation listing rather than one call per
+// instance. Instances that are not registered with SSM are left blank.
+func loadSSMStatus(ctx context.Context, ssmClient *ssm.Client, instances []*InstanceInfo) error {
+	byID := make(map[string]*InstanceInfo, len(instances))
+	for _, inst := range instances {
+		byID[inst.ID] = inst
+	}
+
+	paginator := ssm.NewDescribeInstanceInformationPaginator(ssmClient, &ssm.DescribeInstanceInformationInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, info := range output.InstanceInformationList {
+			if info.InstanceId == nil {
+				continue
+			}
+			inst, ok := byID[*info.InstanceId]
+			if !ok {
+				continue
+			}
+			inst.PingStatus = string(info.PingStatus)
+			if info.LastPingDateTime != nil {
+				inst.LastPing = *info.LastPingDateTime
+			}
+		}
+	}
+	return nil
+}
+
+// Polling intervals for --wait-online. The interval doubles after each
+// attempt up to waitOnlineMaxInterval.
+const (
+	waitOnlineInitialInterval = 2 * time.Second
+	waitOnlineMaxInterval     = 15 * time.Second
+)
+
+// ssmPingStatus returns the instance's current SSM ping status, or "" when
+// the instance is not registered with SSM.
+func ssmPingStatus(ctx context.Context, ssmClient *ssm.Client, instanceID string) (string, error) {
+	info, err := ssmClient.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{
+			{
+				Key:    stringPtr("InstanceIds"),
+				Values: []string{instanceID},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(info.InstanceInformationList) == 0 {
+		return "", nil
+	}
+	return string(info.InstanceInformationList[0].PingStatus), nil
+}
+
+// waitForSSMOnline polls DescribeInstanceInformation until the instance
+// reports Online or timeout elapses. Newly launched instances take a while to
+// register, so a single check often reports them offline.
+func waitForSSMOnline(ctx context.Context, ssmClient *ssm.Client, instanceID string, timeout time.Duration, showProgress bool) error {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	interval := waitOnlineInitialInterval
+	for {
+		status, err := ssmPingStatus(ctx, ssmClient, instanceID)
+		if err != nil {
+			return err
+		}
+		if status == string(ssmtypes.PingStatusOnline) {
+			if showProgress {
+				fmt.Printf("\r%s\r", strings.Repeat(" ", 70))
+			}
+			return nil
+		}
+		if status == "" {
+			status = "NotRegistered"
+		}
+		// The last wait is cut short so the final poll lands on the deadline
+		// rather than giving up a whole interval early.
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if showProgress {
+				fmt.Println()
+			}
+			return fmt.Errorf("instance %s did not come online in SSM within %s (last status: %s)", instanceID, timeout, status)
+		}
+		if showProgress {
+			fmt.Printf("\r%s", color(fmt.Sprintf(
+				"Waiting for SSM agent on %s: %s (%s elapsed)",
+				instanceID, status, time.Since(start).Round(time.Second),
+			), qc.ColorCyan))
+		}
+		time.Sleep(min(interval, remaining))
+		interval = min(interval*2, waitOnlineMaxInterval)
+	}
+}
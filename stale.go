@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// errInstanceGone is wrapped into session errors when the aws CLI reports
+// that the instance no longer exists, e.g. it was terminated after the
+// instance list was loaded.
+var errInstanceGone = errors.New("instance no longer exists")
+
+// instanceGoneMarkers are the error codes the aws CLI prints when the
+// session target does not exist.
+var instanceGoneMarkers = []string{"InvalidInstanceId", "InvalidInstanceID"}
+
+// stderrTailSize is how much of the aws CLI's stderr is kept for inspection.
+const stderrTailSize = 4096
+
+// stderrTail keeps the last stderrTailSize bytes written to it, so a
+// session's error output can be inspected after it is shown to the user.
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = t.buf[len(t.buf)-stderrTailSize:]
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// sessionFailure wraps err from a failed aws CLI session, adding
+// errInstanceGone when its stderr shows the instance does not exist.
+func sessionFailure(what string, err error, stderr *stderrTail) error {
+	output := stderr.String()
+	for _, marker := range instanceGoneMarkers {
+		if strings.Contains(output, marker) {
+			return fmt.Errorf("%s: %w (%v)", what, errInstanceGone, err)
+		}
+	}
+	return fmt.Errorf("%s: %v", what, err)
+}
+
+// removeInstance returns instances without the one with the given ID.
+func removeInstance(instances []*InstanceInfo, id string) []*InstanceInfo {
+	kept := make([]*InstanceInfo, 0, len(instances))
+	for _, inst := range instances {
+		if inst.ID != id {
+			kept = append(kept, inst)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	qc "github.com/bevelwork/quick_color"
+)
+
+// getTargetCandidates fetches the instances --target will be resolved against.
+// IDs, ARNs, and exact names are translated into server-side filters so large
+// accounts are not paginated in full just to find one instance. When the
+// narrowed query finds nothing (e.g. the target is a display name such as
+// "web (2)"), it falls back to fetching everything.
+func getTargetCandidates(ctx context.Context, ec2Client *ec2.Client, filter InstanceFilter, target string) ([]*InstanceInfo, error) {
+	if matches, ok, err := parseTagExpression(target); ok {
+		// Tag expressions are exact, so there is nothing to fall back to.
+		if err != nil {
+			return nil, err
+		}
+		narrowed := filter
+		narrowed.APIFilters = append([]types.Filter{}, filter.APIFilters...)
+		for _, m := range matches {
+			narrowed.APIFilters = append(narrowed.APIFilters, types.Filter{Name: stringPtr("tag:" + m.Key), Values: []string{m.Value}})
+		}
+		return getInstances(ctx, ec2Client, narrowed)
+	}
+	if apiFilter, ok := targetAPIFilter(target, filter.LabelTag); ok {
+		narrowed := filter
+		narrowed.APIFilters = append(append([]types.Filter{}, filter.APIFilters...), apiFilter)
+		instances, err := getInstances(ctx, ec2Client, narrowed)
+		if err != nil {
+			return nil, err
+		}
+		if len(instances) > 0 {
+			return instances, nil
+		}
+	}
+	return getInstances(ctx, ec2Client, filter)
+}
+
+// targetAPIFilter returns the DescribeInstances filter matching target, if one
+// can be expressed server-side.
+func targetAPIFilter(target, labelTag string) (types.Filter, bool) {
+	target = strings.TrimSpace(target)
+	if isARN(target) {
+		id, err := instanceIDFromARN(target)
+		if err != nil {
+			return types.Filter{}, false
+		}
+		target = id
+	}
+	if strings.HasPrefix(target, "i-") {
+		return types.Filter{Name: stringPtr("instance-id"), Values: []string{target}}, true
+	}
+	if isEC2DNSName(target) {
+		name := "private-dns-name"
+		if strings.HasPrefix(strings.ToLower(target), "ec2-") {
+			name = "dns-name"
+		}
+		return types.Filter{Name: stringPtr(name), Values: []string{strings.ToLower(strings.TrimSuffix(target, "."))}}, true
+	}
+	// With a custom label tag the displayed name may come from either tag, so
+	// a single tag filter cannot be used.
+	if labelTag != "" || target == "" {
+		return types.Filter{}, false
+	}
+	return types.Filter{Name: stringPtr("tag:Name"), Values: []string{target}}, true
+}
+
+// isEC2DNSName reports whether target looks like an EC2-assigned private or
+// public DNS name, e.g. ip-10-0-1-5.ec2.internal or
+// ec2-3-80-1-2.compute-1.amazonaws.com.
+func isEC2DNSName(target string) bool {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	return strings.HasSuffix(target, ".compute.internal") ||
+		strings.HasSuffix(target, ".ec2.internal") ||
+		strings.HasSuffix(target, ".compute.amazonaws.com") ||
+		(strings.HasPrefix(target, "ec2-") && strings.HasSuffix(target, ".amazonaws.com"))
+}
+
+// matchesDNSName reports whether target is one of the instance's DNS names.
+// Instances without a DNS name never match, so the many stopped or
+// public-IP-less instances sharing an empty name are not ambiguous.
+func matchesDNSName(inst *InstanceInfo, target string) bool {
+	target = strings.TrimSuffix(target, ".")
+	return (inst.PrivateDNS != "" && strings.EqualFold(inst.PrivateDNS, target)) ||
+		(inst.PublicDNS != "" && strings.EqualFold(inst.PublicDNS, target))
+}
+
+// parseTagExpression parses a tag expression target such as
+// "env=prod,role=web". ok reports whether target is a tag expression at all;
+// err reports a malformed one.
+func parseTagExpression(target string) (matches []TagMatch, ok bool, err error) {
+	target = strings.TrimSpace(target)
+	if isARN(target) || !strings.Contains(target, "=") {
+		return nil, false, nil
+	}
+	for _, part := range strings.Split(target, ",") {
+		key, value, found := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, true, fmt.Errorf("invalid tag expression %q: expected KEY=VALUE[,KEY=VALUE...]", target)
+		}
+		matches = append(matches, TagMatch{Key: key, Value: strings.TrimSpace(value)})
+	}
+	return matches, true, nil
+}
+
+// matchesAllTags reports whether tags satisfy every match.
+func matchesAllTags(tags map[string]string, matches []TagMatch) bool {
+	for _, m := range matches {
+		if value, ok := tags[m.Key]; !ok || value != m.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveTarget finds the instance identified by target, which may be an
+// instance ID, an EC2 instance ARN, an exact instance name, the instance's
+// private or public DNS name, or a tag expression such as "env=prod,role=web".
+func resolveTarget(target string, instances []*InstanceInfo) (*InstanceInfo, error) {
+	target = strings.TrimSpace(target)
+	if tagMatches, ok, err := parseTagExpression(target); ok {
+		if err != nil {
+			return nil, err
+		}
+		matches := []*InstanceInfo{}
+		for _, inst := range instances {
+			if matchesAllTags(inst.Tags, tagMatches) {
+				matches = append(matches, inst)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no instance has tags %s", target)
+		case 1:
+			return matches[0], nil
+		default:
+			return nil, &AmbiguousTargetError{Target: target, Matches: matches}
+		}
+	}
+	if isARN(target) {
+		id, err := instanceIDFromARN(target)
+		if err != nil {
+			return nil, err
+		}
+		target = id
+	}
+
+	if strings.HasPrefix(target, "i-") {
+		for _, inst := range instances {
+			if inst.ID == target {
+				return inst, nil
+			}
+		}
+		return nil, fmt.Errorf("no instance found with ID %s", target)
+	}
+
+	matches := []*InstanceInfo{}
+	for _, inst := range instances {
+		if inst.Name == target || inst.DisplayName == target {
+			matches = append(matches, inst)
+		}
+	}
+	if len(matches) == 0 && target != "" {
+		for _, inst := range instances {
+			if matchesDNSName(inst, target) {
+				matches = append(matches, inst)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no instance found named %q or with that DNS name", target)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, &AmbiguousTargetError{Target: target, Matches: matches}
+	}
+}
+
+// AmbiguousTargetError is returned by resolveTarget when several instances
+// share the target name or tags, e.g. the members of an Auto Scaling group.
+type AmbiguousTargetError struct {
+	Target  string
+	Matches []*InstanceInfo
+}
+
+func (e *AmbiguousTargetError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, inst := range e.Matches {
+		ids[i] = inst.ID
+	}
+	return fmt.Sprintf("%d instances match %q (%s); use an instance ID instead", len(e.Matches), e.Target, strings.Join(ids, ", "))
+}
+
+// resolveTargetInAZ resolves target like resolveTarget. When several
+// instances share the name, any of them will do if the config file has a
+// targetPriority list or preferredAZ is set. The running instances with the
+// most preferred priority tags are narrowed to first, then one in
+// preferredAZ is picked, falling back to one in any AZ. The choice and why
+// it was made are reported on stderr, so they never mix with machine output.
+func resolveTargetInAZ(target string, instances []*InstanceInfo, preferredAZ string) (*InstanceInfo, error) {
+	inst, err := resolveTarget(target, instances)
+	var ambiguous *AmbiguousTargetError
+	if !errors.As(err, &ambiguous) {
+		return inst, err
+	}
+
+	candidates := ambiguous.Matches
+	reasons := []string{}
+	if best, expression, ok := pickByPriority(candidates, targetPriority); ok {
+		candidates = best
+		reasons = append(reasons, fmt.Sprintf(
+			"tagged %s, priority %d of %d", expression, priorityRank(best[0], targetPriority)+1, len(targetPriority),
+		))
+	} else if preferredAZ == "" {
+		return nil, err
+	}
+
+	if preferredAZ == "" {
+		inst = candidates[0]
+	} else {
+		var preferred bool
+		inst, preferred = pickByAZ(candidates, preferredAZ)
+		if !preferred {
+			fmt.Fprintln(os.Stderr, color(fmt.Sprintf(
+				"No preferred instance matching %q in %s; picking one in %s instead", target, preferredAZ, inst.AZ,
+			), qc.ColorYellow))
+		} else {
+			reasons = append(reasons, "in preferred AZ "+inst.AZ)
+		}
+	}
+	why := ""
+	if len(reasons) > 0 {
+		why = " (" + strings.Join(reasons, "; ") + ")"
+	}
+	fmt.Fprintf(os.Stderr, "Picked %s%s from %d instances matching %q\n", inst.ID, why, len(ambiguous.Matches), target)
+	return inst, nil
+}
+
+// strictTarget makes an ambiguous --target an error even when quick_ssm could
+// prompt, so scripts never block on a choice (--strict-target).
+var strictTarget = false
+
+// resolveTargetOrPick resolves target like resolveTargetInAZ. When several
+// instances match and quick_ssm is interactive and not in strict mode, the
+// matches are shown as a mini menu to pick from instead of failing, since a
+// name shared by a couple of instances is the common case. It returns nil
+// when the user exits the prompt. diagnose reports a "?N" selection.
+func resolveTargetOrPick(reader *bufio.Reader, target string, instances []*InstanceInfo, preferredAZ string, opts MenuOptions) (inst *InstanceInfo, diagnose bool, err error) {
+	inst, err = resolveTargetInAZ(target, instances, preferredAZ)
+	var ambiguous *AmbiguousTargetError
+	if !errors.As(err, &ambiguous) || !interactive || strictTarget {
+		return inst, false, err
+	}
+
+	matches := ambiguous.Matches
+	for {
+		fmt.Println(color(fmt.Sprintf("%d instances match %q:", len(matches), target), qc.ColorYellow))
+		printInstanceMenu(matches, opts)
+		picked, diagnose, err := promptForInstance(reader, matches, false)
+		var sortRequest *SortRequest
+		if errors.As(err, &sortRequest) {
+			if isValidSortMode(sortRequest.Mode) {
+				sortInstances(matches, sortRequest.Mode)
+			} else {
+				fmt.Println(color("Sort by one of: "+strings.Join(sortModes, ", "), qc.ColorYellow))
+			}
+			continue
+		}
+		if err != nil || len(picked) == 0 {
+			return nil, false, err
+		}
+		return picked[0], diagnose, nil
+	}
+}
+
+// pickByAZ returns a running instance in az when there is one, otherwise a
+// running instance elsewhere, otherwise the first candidate. preferred
+// reports whether the pick is in az.
+func pickByAZ(candidates []*InstanceInfo, az string) (inst *InstanceInfo, preferred bool) {
+	var fallback *InstanceInfo
+	for _, c := range candidates {
+		if c.State != "running" {
+			continue
+		}
+		if c.AZ == az {
+			return c, true
+		}
+		if fallback == nil {
+			fallback = c
+		}
+	}
+	if fallback == nil {
+		fallback = candidates[0]
+	}
+	return fallback, fallback.AZ == az
+}
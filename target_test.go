@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTagExpression(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    []TagMatch
+		wantOK  bool
+		wantErr bool
+	}{
+		{target: "web-1"},
+		{target: "i-0abc"},
+		{target: "arn:aws:ec2:us-east-1:123456789012:instance/i-0abc"},
+		{target: "env=prod", want: []TagMatch{{Key: "env", Value: "prod"}}, wantOK: true},
+		{
+			target: " env = prod , role=web ",
+			want:   []TagMatch{{Key: "env", Value: "prod"}, {Key: "role", Value: "web"}},
+			wantOK: true,
+		},
+		{target: "env=", want: []TagMatch{{Key: "env", Value: ""}}, wantOK: true},
+		{target: "=prod", wantOK: true, wantErr: true},
+		{target: "env=prod,role", wantOK: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseTagExpression(tt.target)
+		if ok != tt.wantOK || (err != nil) != tt.wantErr {
+			t.Errorf("parseTagExpression(%q) ok = %v, error = %v, want ok = %v, wantErr %v", tt.target, ok, err, tt.wantOK, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseTagExpression(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
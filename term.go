@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// isTerminal reports whether f is attached to a terminal rather than a pipe
+// or file. Other character devices such as /dev/null, which cron and nohup
+// jobs often use for stdin, do not count.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// isCI reports whether quick_ssm appears to be running in a CI pipeline.
+// Most CI providers set CI=true.
+func isCI() bool {
+	value := os.Getenv("CI")
+	return value != "" && value != "false" && value != "0"
+}
+
+// detectInteractive reports whether prompts, colors, and progress output are
+// appropriate: stdin and stdout must be terminals and CI must not be detected.
+func detectInteractive() bool {
+	return !isCI() && isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// terminalWidth returns the width of the terminal attached to f, or 0 when f
+// is not a terminal or its size cannot be determined.
+func terminalWidth(f *os.File) int {
+	if !isTerminal(f) {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
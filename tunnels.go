@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// maxBatchTunnels bounds how many port forwards a single range selection may
+// open, since each one is a separate aws/session-manager-plugin process.
+const maxBatchTunnels = 10
+
+// BatchTunnel is one port forward opened by a range selection.
+type BatchTunnel struct {
+	Instance  *InstanceInfo
+	LocalPort int
+}
+
+// planBatchTunnels assigns sequential local ports starting at basePort to the
+// selected instances. Instances that are not running are skipped with a
+// warning since their tunnels could never open. Ports already in use are an
+// error, or with autoPort are skipped over.
+func planBatchTunnels(instances []*InstanceInfo, basePort int, autoPort bool) ([]BatchTunnel, error) {
+	running := []*InstanceInfo{}
+	for _, inst := range instances {
+		if inst.State != "running" {
+			fmt.Println(color(fmt.Sprintf("⚠️  WARNING: skipping %s (%s), which is %s", inst.DisplayName, inst.ID, inst.State), qc.ColorYellow))
+			continue
+		}
+		running = append(running, inst)
+	}
+	if len(running) == 0 {
+		return nil, fmt.Errorf("none of the selected instances are running")
+	}
+	if len(running) > maxBatchTunnels {
+		return nil, fmt.Errorf("cannot open %d tunnels at once; select at most %d instances", len(running), maxBatchTunnels)
+	}
+	if basePort+len(running)-1 > 65535 {
+		return nil, fmt.Errorf("local ports %d-%d exceed 65535", basePort, basePort+len(running)-1)
+	}
+
+	tunnels := make([]BatchTunnel, len(running))
+	next := basePort
+	for i, inst := range running {
+		port, err := resolveLocalPort(next, autoPort)
+		if err != nil {
+			return nil, err
+		}
+		tunnels[i] = BatchTunnel{Instance: inst, LocalPort: port}
+		next = port + 1
+	}
+	return tunnels, nil
+}
+
+// openBatchTunnels forwards the --port-forward spec to each selected instance,
+// giving each its own local port counting up from the spec's local port.
+// record is called for every instance a tunnel is opened to.
+func openBatchTunnels(selected []*InstanceInfo, portForward string, autoPort bool, opts SessionOptions, record func(*InstanceInfo)) error {
+	localPort, remotePort, err := parsePortForwardFlag(portForward)
+	if err != nil {
+		return err
+	}
+	tunnels, err := planBatchTunnels(selected, localPort, autoPort)
+	if err != nil {
+		return err
+	}
+	printBatchTunnels(tunnels, remotePort)
+	for _, t := range tunnels {
+		record(t.Instance)
+	}
+	return startBatchPortForwards(tunnels, remotePort, opts)
+}
+
+// printBatchTunnels prints the local port each instance is reachable on.
+func printBatchTunnels(tunnels []BatchTunnel, remotePort int) {
+	longestName := 0
+	for _, t := range tunnels {
+		longestName = max(longestName, len(t.Instance.DisplayName))
+	}
+	fmt.Printf("\n%s\n", colorBold(fmt.Sprintf("Opening %d tunnels to remote port %d:", len(tunnels), remotePort), qc.ColorCyan))
+	for i, t := range tunnels {
+		rowColor := qc.AlternatingColor(i, qc.ColorWhite, qc.ColorCyan)
+		fmt.Println(color(fmt.Sprintf("  localhost:%-5d -> %-*s %s", t.LocalPort, longestName, t.Instance.DisplayName, t.Instance.ID), rowColor))
+	}
+	fmt.Println("Press Ctrl-C to close all tunnels.")
+}
+
+// startBatchPortForwards opens every tunnel in parallel and blocks until they
+// have all exited. An interrupt, or reaching the maximum session duration,
+// closes all of them. Tunnels that fail are reported without closing the
+// others.
+func startBatchPortForwards(tunnels []BatchTunnel, remotePort int, opts SessionOptions) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	var (
+		mu       sync.Mutex
+		cmds     []*exec.Cmd
+		failed   int
+		stopping bool
+		wg       sync.WaitGroup
+	)
+	stopAll := func() {
+		mu.Lock()
+		stopping = true
+		mu.Unlock()
+		stopTunnels(cmds)
+	}
+	for _, t := range tunnels {
+		cmd := exec.Command("aws", opts.portForwardArgs(t.Instance.ID, t.LocalPort, remotePort, "")...)
+		cmd.Env = opts.environ()
+		// The plugin's "Waiting for connections" chatter from every tunnel
+		// would drown out the mapping, so only errors are shown.
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			stopAll()
+			wg.Wait()
+			return fmt.Errorf("failed to start tunnel to %s: %v", t.Instance.ID, err)
+		}
+		cmds = append(cmds, cmd)
+
+		wg.Add(1)
+		go func(t BatchTunnel, cmd *exec.Cmd) {
+			defer wg.Done()
+			err := cmd.Wait()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && !stopping {
+				failed++
+				log.Printf("Tunnel localhost:%d -> %s closed: %v", t.LocalPort, t.Instance.ID, err)
+			}
+		}(t, cmd)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-sigChan:
+		log.Println("Received interrupt signal, closing all tunnels...")
+		stopAll()
+		<-done
+		return nil
+	case <-opts.deadline():
+		log.Printf("Maximum session duration of %s reached, closing all tunnels...", opts.MaxDuration)
+		stopAll()
+		<-done
+		return nil
+	case <-done:
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tunnels failed", failed, len(tunnels))
+	}
+	return nil
+}
+
+// stopTunnels asks every started tunnel process to exit.
+func stopTunnels(cmds []*exec.Cmd) {
+	for _, cmd := range cmds {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	qc "github.com/bevelwork/quick_color"
+)
+
+// waitForInstancesInterval is how often --wait-for-instances re-lists
+// instances.
+const waitForInstancesInterval = 10 * time.Second
+
+// pollForInstances calls fetch until it returns at least one instance or
+// timeout elapses, for fleets that are still launching. With showProgress a
+// countdown to the next attempt is shown. When the timeout elapses an empty
+// list is returned without an error. Status lines without showProgress go to
+// stderr so they never mix with --json, --csv, or --porcelain output.
+func pollForInstances(fetch func() ([]*InstanceInfo, error), timeout time.Duration, showProgress bool) ([]*InstanceInfo, error) {
+	deadline := time.Now().Add(timeout)
+	if !showProgress {
+		fmt.Fprintf(os.Stderr, "No matching instances yet; waiting up to %s for them to appear\n", timeout)
+	}
+	for {
+		wait := min(waitForInstancesInterval, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+		for next := time.Now().Add(wait); time.Now().Before(next); {
+			if showProgress {
+				fmt.Printf("\r%s", color(fmt.Sprintf(
+					"No matching instances yet; retrying in %s (%s left)",
+					time.Until(next).Round(time.Second), time.Until(deadline).Round(time.Second),
+				), qc.ColorCyan))
+			}
+			time.Sleep(min(time.Second, time.Until(next)))
+		}
+
+		instances, err := fetch()
+		if err != nil {
+			if showProgress {
+				fmt.Println()
+			}
+			return nil, err
+		}
+		if len(instances) > 0 {
+			if showProgress {
+				fmt.Printf("\r%s\r", strings.Repeat(" ", 70))
+			}
+			return instances, nil
+		}
+	}
+	if showProgress {
+		fmt.Println()
+	}
+	fmt.Fprintln(os.Stderr, color(fmt.Sprintf("No instances appeared within %s", timeout), qc.ColorYellow))
+	return nil, nil
+}